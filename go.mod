@@ -4,7 +4,7 @@ go 1.16
 
 require (
 	github.com/hajimehoshi/oto v0.7.0
-	gitlab.com/gomidi/midi v1.23.0 // indirect
+	gitlab.com/gomidi/midi v1.23.0
 	gitlab.com/gomidi/rtmididrv v0.11.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 )
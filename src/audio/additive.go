@@ -0,0 +1,211 @@
+package audio
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"strconv"
+)
+
+const maxPartials = 256
+
+// ----- Additive Params ----- //
+
+type additiveParams struct {
+	partials      []float64 // amplitudes, length: maxPartials (0 is the fundamental)
+	tilt          float64   // dB/oct
+	oddEven       float64   // -1 (odd only) ~ 1 (even only), except the fundamental
+	inharmonicity float64   // 0 ~ , stiffness like piano strings
+	stretch       float64   // cent/oct
+}
+type additiveJSON struct {
+	Partials      []float64 `json:"partials"`
+	Tilt          float64   `json:"tilt"`
+	OddEven       float64   `json:"oddEven"`
+	Inharmonicity float64   `json:"inharmonicity"`
+	Stretch       float64   `json:"stretch"`
+}
+
+func newAdditiveParams() *additiveParams {
+	partials := make([]float64, maxPartials)
+	partials[0] = 1
+	return &additiveParams{partials: partials}
+}
+func (a *additiveParams) applyJSON(data json.RawMessage) {
+	var j additiveJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil || len(j.Partials) > maxPartials {
+		log.Println("failed to apply JSON to additiveParams")
+		return
+	}
+	for i := range a.partials {
+		a.partials[i] = 0
+	}
+	copy(a.partials, j.Partials)
+	a.tilt = j.Tilt
+	a.oddEven = j.OddEven
+	a.inharmonicity = math.Max(0, j.Inharmonicity)
+	a.stretch = j.Stretch
+}
+func (a *additiveParams) toJSON() json.RawMessage {
+	// trailing silent partials are omitted
+	n := len(a.partials)
+	for n > 0 && a.partials[n-1] == 0 {
+		n--
+	}
+	return toRawMessage(&additiveJSON{
+		Partials:      a.partials[:n],
+		Tilt:          a.tilt,
+		OddEven:       a.oddEven,
+		Inharmonicity: a.inharmonicity,
+		Stretch:       a.stretch,
+	})
+}
+func (a *additiveParams) set(key string, value string) error {
+	switch key {
+	case "tilt":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.tilt = value
+	case "odd_even":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.oddEven = value
+	case "inharmonicity":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.inharmonicity = math.Max(0, value)
+	case "stretch":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.stretch = value
+	}
+	return nil
+}
+func (a *additiveParams) continuousParam(key string) *float64 {
+	switch key {
+	case "tilt":
+		return &a.tilt
+	case "odd_even":
+		return &a.oddEven
+	case "inharmonicity":
+		return &a.inharmonicity
+	case "stretch":
+		return &a.stretch
+	}
+	return nil
+}
+
+// frequency ratio of the n-th harmonic (1 is the fundamental)
+func (a *additiveParams) ratio(n int) float64 {
+	x := float64(n)
+	return x * math.Sqrt(1+a.inharmonicity*x*x) * math.Pow(2, a.stretch*math.Log2(x)/1200)
+}
+func (a *additiveParams) gain(n int) float64 {
+	gain := a.partials[n-1] * math.Pow(10, a.tilt*math.Log2(float64(n))/20)
+	if n > 1 {
+		if n%2 == 1 {
+			gain *= math.Min(1, 1-a.oddEven)
+		} else {
+			gain *= math.Min(1, 1+a.oddEven)
+		}
+	}
+	return gain
+}
+
+// ----- Partials ----- //
+
+var sineWT = makeSineWavetable(4096)
+
+func makeSineWavetable(samples int) *wavetable {
+	wt := newWavetable(samples)
+	wt.generate(samples, math.Sin)
+	return wt
+}
+
+// audible partials of an additive oscillator
+type partials struct {
+	numbers []int // index of each audible partial (0 is the fundamental)
+	ratios  []float64
+	gains   []float64
+	phases  []float64 // by partial index, length: maxPartials
+}
+
+func newPartials() *partials {
+	return &partials{
+		numbers: make([]int, 0, maxPartials),
+		ratios:  make([]float64, 0, maxPartials),
+		gains:   make([]float64, 0, maxPartials),
+		phases:  make([]float64, maxPartials),
+	}
+}
+
+// called on note on
+func (p *partials) init(a *additiveParams) {
+	p.update(a)
+	p.reset()
+}
+
+// called for each block while sounding, skipping silent partials and keeping the phases
+func (p *partials) update(a *additiveParams) {
+	p.numbers = p.numbers[:0]
+	p.ratios = p.ratios[:0]
+	p.gains = p.gains[:0]
+	sum := 0.0
+	for n := 1; n <= maxPartials; n++ {
+		if a.partials[n-1] == 0 {
+			continue
+		}
+		gain := a.gain(n)
+		if gain == 0 {
+			continue
+		}
+		ratio := a.ratio(n)
+		if math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+			continue
+		}
+		p.numbers = append(p.numbers, n-1)
+		p.ratios = append(p.ratios, ratio)
+		p.gains = append(p.gains, gain)
+		sum += math.Abs(gain)
+	}
+	if sum > 1 {
+		for i := range p.gains {
+			p.gains[i] /= sum
+		}
+	}
+}
+func (p *partials) reset() {
+	for i := range p.phases {
+		p.phases[i] = 0
+	}
+}
+
+// partials above the Nyquist frequency are removed, fading out from 90% of it
+func (p *partials) valueAt(freq float64, phaseShift float64) float64 {
+	nyquist := float64(sampleRate) / 2
+	value := 0.0
+	for i, ratio := range p.ratios {
+		f := freq * ratio
+		if f >= nyquist {
+			continue
+		}
+		gain := p.gains[i] * math.Min(1, (nyquist-f)/(nyquist*0.1))
+		value += sineWT.getAtPhaseWithInterpolation(p.phases[p.numbers[i]]+phaseShift*ratio, interpolationLinear) * gain
+	}
+	return value
+}
+func (p *partials) advance(freq float64) {
+	for i, ratio := range p.ratios {
+		n := p.numbers[i]
+		p.phases[n] = math.Mod(p.phases[n]+2.0*math.Pi*freq*ratio/float64(sampleRate), 2.0*math.Pi)
+	}
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAdditiveParams(t *testing.T) {
+	a := newAdditiveParams()
+	expectNearlyEqual(t, a.ratio(3), 3)
+	expectNoError(t, a.set("stretch", "1200"))
+	expectNearlyEqual(t, a.ratio(2), 4)
+	expectNoError(t, a.set("stretch", "0"))
+	expectNoError(t, a.set("inharmonicity", "0.01"))
+	expectNearlyEqual(t, a.ratio(10), 10*math.Sqrt(2))
+
+	a.partials[1] = 1
+	a.partials[2] = 1
+	expectNoError(t, a.set("tilt", "-6"))
+	expectNearlyEqual(t, a.gain(1), 1)
+	expectNearlyEqual(t, a.gain(2), math.Pow(10, -6.0/20))
+	expectNoError(t, a.set("tilt", "0"))
+	expectNoError(t, a.set("odd_even", "1"))
+	expectNearlyEqual(t, a.gain(1), 1)
+	expectNearlyEqual(t, a.gain(2), 1)
+	expectNearlyEqual(t, a.gain(3), 0)
+
+	a2 := newAdditiveParams()
+	a2.applyJSON(a.toJSON())
+	expectEqual(t, a2.partials[2], 1.0)
+	expectEqual(t, a2.oddEven, 1.0)
+	expectEqual(t, a2.inharmonicity, 0.01)
+
+	// negative values are clamped
+	expectNoError(t, a.set("inharmonicity", "-0.01"))
+	expectEqual(t, a.inharmonicity, 0.0)
+}
+
+func TestPartials(t *testing.T) {
+	a := newAdditiveParams()
+	a.partials[1] = 1
+	p := newPartials()
+	p.init(a)
+	expectEqual(t, len(p.ratios), 2)
+	expectNearlyEqual(t, p.gains[0], 0.5)
+	for i := 0; i < 100; i++ {
+		phase := 2 * math.Pi * 100 * float64(i) / sampleRate
+		expectNearlyEqual(t, math.Round(p.valueAt(100, 0)*1000)/1000, math.Round((math.Sin(phase)+math.Sin(phase*2))/2*1000)/1000)
+		p.advance(100)
+	}
+	// the second partial exceeds the Nyquist frequency
+	p.reset()
+	p.advance(15000)
+	expectNearlyEqual(t, math.Round(p.valueAt(15000, 0)*1000)/1000, math.Round(math.Sin(2*math.Pi*15000/sampleRate)/2*1000)/1000)
+
+	// partials with invalid ratios (e.g. modulated to negative inharmonicity) are skipped
+	a.inharmonicity = -0.01
+	p.init(a)
+	expectEqual(t, len(p.ratios), 2)
+	a.inharmonicity = -1
+	p.init(a)
+	expectEqual(t, len(p.ratios), 1)
+	a.inharmonicity = 0
+
+	// as an oscillator
+	params := newOscParams()
+	params.enabled = true
+	params.kind = waveAdditive
+	o := newOsc(true)
+	o.initWithNote(params, newTuning(), 69, 127)
+	o.step(1, 0)
+	expectNearlyEqual(t, math.Round(o.step(1, 0)*1000)/1000, math.Round(math.Sin(2*math.Pi*442/sampleRate)*1000)/1000)
+
+	// edited while sounding
+	p3 := newParams()
+	p3.oscParams[0].kind = waveAdditive
+	v := newDecoratedOsc(0)
+	v.initWithNote(p3.oscParams, newTuning(), 69, 127)
+	for i := 0; i < 10; i++ {
+		v.oscs[0].step(1, 0)
+	}
+	phase := v.oscs[0].partials.phases[0]
+	p3.oscParams[0].additive.partials[2] = 1
+	v.applyParams(p3.oscParams, p3.fmParams, p3.adsrParams, p3.noteFilterParams, p3.filterParams, p3.formantParams, p3.lfoParams, p3.envelopeParams, p3.expressionParams, newTuning(), defaultBpm)
+	expectEqual(t, len(v.oscs[0].partials.ratios), 2)
+	expectNearlyEqual(t, v.oscs[0].partials.ratios[1], 3)
+	expectEqual(t, v.oscs[0].partials.phases[0], phase)
+
+	p2 := newParams()
+	value, err := p2.continuousParam([]string{"osc_partial", "1", "255"})
+	expectNoError(t, err)
+	*value = 0.5
+	expectEqual(t, p2.oscParams[1].additive.partials[255], 0.5)
+}
@@ -79,6 +79,19 @@ func (a *adsrParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (a *adsrParams) continuousParam(key string) *float64 {
+	switch key {
+	case "attack":
+		return &a.attack
+	case "decay":
+		return &a.decay
+	case "sustain":
+		return &a.sustain
+	case "release":
+		return &a.release
+	}
+	return nil
+}
 
 // ----- ADSR ----- //
 
@@ -124,8 +137,15 @@ func (a *adsr) noteOn() {
 	a.tvalue.linear(a.attack, a.peak)
 }
 func (a *adsr) noteOff() {
+	a.noteOffWithReleaseRatio(1)
+}
+func (a *adsr) noteOffWithReleaseRatio(ratio float64) {
 	a.phase = phaseRelease
-	a.tvalue.exponential(a.release, a.base, 0.001)
+	a.tvalue.exponential(a.release*ratio, a.base, 0.001)
+}
+func (a *adsr) reset() {
+	a.phase = phaseNone
+	a.tvalue.init(a.base)
 }
 func (a *adsr) step() {
 	switch a.phase {
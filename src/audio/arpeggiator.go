@@ -0,0 +1,362 @@
+package audio
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// ----- Arpeggiator Mode ----- //
+
+//go:generate go run ../gen/main.go -- arp_mode.gen.go
+/*
+generate-enum arpMode
+
+arpUp up
+arpDown down
+arpUpDown up-down
+arpRandom random
+arpAsPlayed as-played
+
+EOF
+*/
+
+// ----- Arpeggiator Params ----- //
+
+type arpParams struct {
+	enabled  bool
+	mode     int
+	octaves  int     // 1 ~ 4
+	gate     float64 // 0 ~ 1, ratio of a step
+	swing    float64 // 0 ~ 0.5, ratio of a step by which every second step is delayed
+	latch    bool
+	rateType string // "absolute" or "sync"
+	rate     float64
+	division string // used when rateType is "sync"
+}
+
+type arpJSON struct {
+	Enabled  bool    `json:"enabled"`
+	Mode     string  `json:"mode"`
+	Octaves  int     `json:"octaves"`
+	Gate     float64 `json:"gate"`
+	Swing    float64 `json:"swing"`
+	Latch    bool    `json:"latch"`
+	RateType string  `json:"rateType"`
+	Rate     float64 `json:"rate"`
+	Division string  `json:"division"`
+}
+
+func newArpParams() *arpParams {
+	return &arpParams{
+		enabled:  false,
+		mode:     arpUp,
+		octaves:  1,
+		gate:     0.5,
+		swing:    0,
+		latch:    false,
+		rateType: "sync",
+		rate:     125,
+		division: "1/16",
+	}
+}
+func (a *arpParams) applyJSON(data json.RawMessage) {
+	var j arpJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to arpParams")
+		return
+	}
+	a.enabled = j.Enabled
+	a.mode = arpModeFromString(j.Mode)
+	a.octaves = j.Octaves
+	a.gate = j.Gate
+	a.swing = j.Swing
+	a.latch = j.Latch
+	a.rateType = j.RateType
+	a.rate = j.Rate
+	a.division = j.Division
+}
+func (a *arpParams) toJSON() json.RawMessage {
+	return toRawMessage(&arpJSON{
+		Enabled:  a.enabled,
+		Mode:     arpModeToString(a.mode),
+		Octaves:  a.octaves,
+		Gate:     a.gate,
+		Swing:    a.swing,
+		Latch:    a.latch,
+		RateType: a.rateType,
+		Rate:     a.rate,
+		Division: a.division,
+	})
+}
+func (a *arpParams) set(key string, value string) error {
+	switch key {
+	case "enabled":
+		a.enabled = value == "true"
+	case "mode":
+		a.mode = arpModeFromString(value)
+	case "octaves":
+		value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		a.octaves = int(value)
+	case "gate":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.gate = value
+	case "swing":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.swing = value
+	case "latch":
+		a.latch = value == "true"
+	case "rate_type":
+		a.rateType = value
+	case "rate":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		a.rate = value
+	case "division":
+		_, err := divisionToBeats(value)
+		if err != nil {
+			return err
+		}
+		a.division = value
+	}
+	return nil
+}
+func (a *arpParams) continuousParam(key string) *float64 {
+	switch key {
+	case "gate":
+		return &a.gate
+	case "swing":
+		return &a.swing
+	case "rate":
+		return &a.rate
+	}
+	return nil
+}
+func (a *arpParams) stepMillis(bpm float64) float64 {
+	millis := a.rate
+	if a.rateType == "sync" {
+		millis = divisionToMillis(a.division, bpm)
+	}
+	if millis < 1 {
+		millis = 1
+	}
+	return millis
+}
+
+// ----- Arpeggiator ----- //
+
+type arpNote struct {
+	note     int
+	velocity int
+	channel  int
+	pressed  bool // false if only latched
+}
+
+type arpeggiator struct {
+	held      []*arpNote // in the order played
+	sequence  []*arpNote
+	index     int
+	countdown float64 // samples until the next step
+	swung     bool    // whether the next step is the delayed one
+	sounding  *arpNote
+	gateLeft  float64 // samples until the sounding note is released
+	running   bool
+}
+
+func newArpeggiator() *arpeggiator {
+	return &arpeggiator{
+		held:     make([]*arpNote, 0, 128),
+		sequence: make([]*arpNote, 0, 128*4),
+	}
+}
+
+// replaces note events in the first `length` slots with generated ones
+func (a *arpeggiator) process(events [][]*midiEvent, length int, p *arpParams, bpm float64, send func(data []byte)) {
+	if !p.enabled {
+		if a.running || len(a.held) > 0 {
+			a.stop(events, 0, send)
+		}
+		return
+	}
+	stepLength := p.stepMillis(bpm) / 1000 * sampleRate
+	for i := 0; i < length; i++ {
+		a.receive(events, i, p)
+		if a.sounding != nil {
+			a.gateLeft--
+			if a.gateLeft <= 0 || len(a.held) == 0 {
+				a.release(events, i, send)
+			}
+		}
+		if len(a.held) == 0 {
+			a.running = false
+			continue
+		}
+		if !a.running {
+			a.running = true
+			a.index = 0
+			a.countdown = 0
+			a.swung = false
+		}
+		if a.countdown <= 0 {
+			a.release(events, i, send)
+			a.trigger(events, i, p, stepLength, send)
+			swing := p.swing
+			if a.swung {
+				swing = -swing
+			}
+			a.countdown += stepLength * (1 + swing)
+			a.swung = !a.swung
+		}
+		a.countdown--
+	}
+}
+
+func (a *arpeggiator) receive(events [][]*midiEvent, i int, p *arpParams) {
+	kept := events[i][:0]
+	for _, e := range events[i] {
+		switch data := e.event.(type) {
+		case *noteOn:
+			if p.latch && !a.anyPressed() {
+				a.held = a.held[:0] // a new chord replaces the latched one
+			}
+			a.remove(data.note, e.channel)
+			a.held = append(a.held, &arpNote{note: data.note, velocity: data.velocity, channel: e.channel, pressed: true})
+		case *noteOff:
+			for _, n := range a.held {
+				if n.note == data.note && n.channel == e.channel {
+					n.pressed = false
+				}
+			}
+			if !p.latch {
+				a.remove(data.note, e.channel)
+			}
+		case *controlChange:
+			if data.number == ccAllNotesOff || data.number == ccAllSoundOff {
+				a.held = a.held[:0]
+			}
+			kept = append(kept, e)
+		default:
+			kept = append(kept, e)
+		}
+	}
+	events[i] = kept
+	if !p.latch {
+		for j := len(a.held) - 1; j >= 0; j-- {
+			if !a.held[j].pressed {
+				a.held = append(a.held[:j], a.held[j+1:]...)
+			}
+		}
+	}
+}
+func (a *arpeggiator) anyPressed() bool {
+	for _, n := range a.held {
+		if n.pressed {
+			return true
+		}
+	}
+	return false
+}
+func (a *arpeggiator) remove(note int, channel int) {
+	for j := len(a.held) - 1; j >= 0; j-- {
+		if a.held[j].note == note && a.held[j].channel == channel {
+			a.held = append(a.held[:j], a.held[j+1:]...)
+		}
+	}
+}
+
+func (a *arpeggiator) trigger(events [][]*midiEvent, i int, p *arpParams, stepLength float64, send func(data []byte)) {
+	a.makeSequence(p)
+	if len(a.sequence) == 0 {
+		return
+	}
+	var n *arpNote
+	if p.mode == arpRandom {
+		n = a.sequence[rand.Intn(len(a.sequence))]
+	} else {
+		n = a.sequence[a.index%len(a.sequence)]
+	}
+	a.index++
+	a.sounding = n
+	a.gateLeft = stepLength * p.gate
+	addGeneratedNote(events, i, n.channel, &noteOn{note: n.note, velocity: n.velocity}, send)
+}
+func (a *arpeggiator) release(events [][]*midiEvent, i int, send func(data []byte)) {
+	if a.sounding == nil {
+		return
+	}
+	addGeneratedNote(events, i, a.sounding.channel, &noteOff{note: a.sounding.note, velocity: defaultReleaseVelocity}, send)
+	a.sounding = nil
+}
+func (a *arpeggiator) stop(events [][]*midiEvent, i int, send func(data []byte)) {
+	a.release(events, i, send)
+	a.held = a.held[:0]
+	a.running = false
+}
+
+// up:      C E G C' E' G'
+// down:    G' E' C' G E C
+// up-down: C E G C' E' G' E' C' G E
+func (a *arpeggiator) makeSequence(p *arpParams) {
+	notes := a.sequence[:0]
+	octaves := p.octaves
+	if octaves < 1 {
+		octaves = 1
+	}
+	for octave := 0; octave < octaves; octave++ {
+		for _, n := range a.held {
+			note := n.note + 12*octave
+			if note >= 128 {
+				continue
+			}
+			notes = append(notes, &arpNote{note: note, velocity: n.velocity, channel: n.channel})
+		}
+	}
+	if p.mode != arpAsPlayed {
+		sort.SliceStable(notes, func(i, j int) bool {
+			return notes[i].note < notes[j].note
+		})
+	}
+	switch p.mode {
+	case arpDown:
+		for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+			notes[i], notes[j] = notes[j], notes[i]
+		}
+	case arpUpDown:
+		for i := len(notes) - 2; i >= 1; i-- {
+			notes = append(notes, notes[i])
+		}
+	}
+	a.sequence = notes
+}
+
+func addEvent(events [][]*midiEvent, i int, channel int, event interface{}) {
+	events[i] = append(events[i], &midiEvent{offset: float64(i) * secPerSample, channel: channel, event: event})
+}
+
+// also sends the note as MIDI data (e.g. to MIDI OUT)
+func addGeneratedNote(events [][]*midiEvent, i int, channel int, event interface{}, send func(data []byte)) {
+	addEvent(events, i, channel, event)
+	if channel == channelOmni {
+		channel = 0
+	}
+	switch e := event.(type) {
+	case *noteOn:
+		send([]byte{0x90 | byte(channel), byte(e.note), byte(e.velocity)})
+	case *noteOff:
+		send([]byte{0x80 | byte(channel), byte(e.note), byte(e.velocity)})
+	}
+}
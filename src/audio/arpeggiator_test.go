@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"testing"
+)
+
+func ignoreMidi(data []byte) {}
+
+func TestArpeggiator(t *testing.T) {
+	p := newArpParams()
+	p.enabled = true
+	p.mode = arpUpDown
+	p.octaves = 2
+	p.rateType = "absolute"
+	p.rate = 1 // 48 samples
+	p.gate = 1
+	a := newArpeggiator()
+	events := make([][]*midiEvent, samplesPerCycle*2)
+	events[0] = []*midiEvent{{event: &noteOn{note: 67, velocity: 100}}, {event: &noteOn{note: 60, velocity: 100}}}
+	a.process(events, 48*6, p, defaultBpm, ignoreMidi)
+	notes := make([]int, 0)
+	for i, slot := range events {
+		for _, e := range slot {
+			if n, ok := e.event.(*noteOn); ok {
+				notes = append(notes, n.note)
+				expectEqual(t, i%48, 0)
+			}
+		}
+	}
+	expected := []int{60, 67, 72, 79, 72, 67}
+	expectEqual(t, len(notes), len(expected))
+	for i := range expected {
+		expectEqual(t, notes[i], expected[i])
+	}
+
+	// releasing all keys stops the arpeggio
+	events = make([][]*midiEvent, samplesPerCycle*2)
+	events[0] = []*midiEvent{{event: &noteOff{note: 60}}, {event: &noteOff{note: 67}}}
+	a.process(events, samplesPerCycle, p, defaultBpm, ignoreMidi)
+	expectEqual(t, len(events[0]), 1)
+	_, ok := events[0][0].event.(*noteOff)
+	expectEqual(t, ok, true)
+	expectEqual(t, a.running, false)
+}
+
+func TestArpeggiatorLatch(t *testing.T) {
+	p := newArpParams()
+	p.enabled = true
+	p.latch = true
+	a := newArpeggiator()
+	events := make([][]*midiEvent, samplesPerCycle*2)
+	events[0] = []*midiEvent{{event: &noteOn{note: 60, velocity: 100}}}
+	events[1] = []*midiEvent{{event: &noteOff{note: 60}}}
+	a.process(events, samplesPerCycle, p, defaultBpm, ignoreMidi)
+	expectEqual(t, len(a.held), 1)
+	events = make([][]*midiEvent, samplesPerCycle*2)
+	events[0] = []*midiEvent{{event: &noteOn{note: 64, velocity: 100}}}
+	a.process(events, samplesPerCycle, p, defaultBpm, ignoreMidi)
+	expectEqual(t, len(a.held), 1)
+	expectEqual(t, a.held[0].note, 64)
+}
@@ -26,7 +26,7 @@ const bytesPerSample = bitDepthInBytes * channelNum
 const bufferSizeInBytes = samplesPerCycle * bytesPerSample // should be >= 4096
 const secPerSample = 1.0 / sampleRate
 const responseDelay = secPerSample * samplesPerCycle
-const baseFreq = 442.0
+const baseFreq = 442.0 // default reference pitch of A4
 const oscGain = 0.07
 
 var fft = NewFFT(fftSize, false)
@@ -60,6 +60,8 @@ func noteToFreq(note int) float64 {
 // 	return note
 // }
 
+// fixed 12-TET grid to select band-limited wavetables by actual frequency,
+// so any tuning (see tuning.go) picks the tables consistently
 var freqs = makeFreqs()
 
 func makeFreqs() []float64 {
@@ -91,8 +93,15 @@ func freqToNote(freq float64) int {
 	}
 	panic("infinite loop in freqToNote()")
 }
-func velocityToGain(velocity int, velSense float64) float64 {
-	return 1.0 - (1.0-float64(velocity)/127.0)*velSense
+
+// returns the note below the frequency and the position (0 ~ 1) toward the next note in pitch
+func freqToNoteWithFraction(freq float64) (int, float64) {
+	note := freqToNote(freq)
+	if note+1 >= len(freqs) || freq <= freqs[note] {
+		return note, 0
+	}
+	t := math.Log2(freq/freqs[note]) * 12
+	return note, math.Min(t, 1)
 }
 func toRawMessage(v interface{}) json.RawMessage {
 	bytes, err := json.Marshal(v)
@@ -104,9 +113,23 @@ func toRawMessage(v interface{}) json.RawMessage {
 
 // ----- MIDI Event ----- //
 
+const (
+	ccBankSelectMSB = 0
+	ccDataEntryMSB  = 6
+	ccBankSelectLSB = 32
+	ccSustain       = 64
+	ccSostenuto     = 66
+	ccTimbre        = 74
+	ccRPNLSB        = 100
+	ccRPNMSB        = 101
+	ccAllSoundOff   = 120
+	ccAllNotesOff   = 123
+)
+
 type midiEvent struct {
-	offset float64
-	event  interface{}
+	offset  float64
+	channel int
+	event   interface{}
 }
 
 type noteOn struct {
@@ -114,7 +137,23 @@ type noteOn struct {
 	velocity int
 }
 type noteOff struct {
-	note int
+	note     int
+	velocity int
+}
+type controlChange struct {
+	number int
+	value  int
+}
+type pitchBend struct {
+	semitones float64
+	master    bool // applies to all notes in the MPE zone
+}
+type channelPressure struct {
+	value float64 // 0 ~ 1
+}
+type polyPressure struct {
+	note  int
+	value float64 // 0 ~ 1
 }
 
 // ----- Changes ----- //
@@ -151,27 +190,76 @@ func (c *Changes) Delete(key string) {
 
 type state struct {
 	sync.Mutex
-	*params
-	events      [][]*midiEvent // length: samplesPerCycle * 2
-	monoOsc     *monoOsc
-	polyOsc     *polyOsc
-	echo        *echo
+	parts       []*part
+	selected    int
+	transport   *transport
+	scheduler   *scheduler
+	clock       *clock
+	midi        *midiSettings
+	tuning      *tuning
 	pos         int64
-	out         []float64 // length: fftSize
+	out         [channelNum][]float64 // length: fftSize
 	lastRead    float64
 	processTime float64
 }
 
 func newState() *state {
-	return &state{
-		events:  make([][]*midiEvent, samplesPerCycle*2),
-		params:  newParams(),
-		monoOsc: newMonoOsc(),
-		polyOsc: newPolyOsc(),
-		echo:    &echo{delay: &delay{}},
-		pos:     0,
-		out:     make([]float64, fftSize),
+	parts := make([]*part, maxParts)
+	for i := 0; i < maxParts; i++ {
+		parts[i] = newPart(i)
+	}
+	s := &state{
+		parts:     parts,
+		selected:  0,
+		transport: newTransport(),
+		scheduler: newScheduler(),
+		clock:     newClock(),
+		midi:      newMidiSettings(),
+		tuning:    newTuning(),
+		pos:       0,
 	}
+	for ch := 0; ch < channelNum; ch++ {
+		s.out[ch] = make([]float64, fftSize)
+	}
+	return s
+}
+func (s *state) selectedPart() *part {
+	return s.parts[s.selected]
+}
+func (s *state) polyphony() int {
+	polyphony := 0
+	for _, p := range s.parts {
+		polyphony += len(p.polyOsc.active) + len(p.monoOsc.voices)
+	}
+	return polyphony
+}
+
+// returns defaultValue if the optional argument is omitted (-1 means required)
+func parseMidiValue(command []string, i int, min int, max int, defaultValue int) (int, error) {
+	if i >= len(command) {
+		if defaultValue < 0 {
+			return 0, fmt.Errorf("missing argument in %v", command)
+		}
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseInt(command[i], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if value < int64(min) || value > int64(max) {
+		return 0, fmt.Errorf("%v is out of range [%v, %v]", value, min, max)
+	}
+	return int(value), nil
+}
+func parsePartIndex(s string) (int, error) {
+	index, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 || index >= maxParts {
+		return 0, fmt.Errorf("invalid part index %v", s)
+	}
+	return int(index), nil
 }
 
 // ----- Audio ----- //
@@ -182,9 +270,11 @@ type Audio struct {
 	otoContext    *oto.Context
 	presetManager *presetManager
 	CommandCh     chan []string
+	MidiOutCh     chan []byte
 	state         *state
 	Changes       *Changes
 	fftResult     []float64 // length: fftSize
+	sf2List       json.RawMessage
 }
 
 var _ io.Reader = (*Audio)(nil)
@@ -201,34 +291,47 @@ func (a *Audio) Read(buf []byte) (int, error) {
 		bufSamples := int64(len(buf) / bytesPerSample)
 
 		offset := a.state.pos % fftSize
-		out := a.state.out[offset : offset+bufSamples]
-
-		a.state.echo.applyParams(a.state.echoParams)
-		if a.state.polyMode {
-			a.state.polyOsc.calc(a.state.events, a.state.oscParams, a.state.adsrParams, a.state.noteFilterParams, a.state.filterParams, a.state.formantParams, a.state.lfoParams, a.state.envelopeParams, a.state.velSense, a.state.echo, out)
-		} else {
-			a.state.monoOsc.calc(a.state.events, a.state.oscParams, a.state.adsrParams, a.state.noteFilterParams, a.state.filterParams, a.state.formantParams, a.state.lfoParams, a.state.envelopeParams, a.state.velSense, a.state.glideTime, a.state.echo, out)
+		outL := a.state.out[0][offset : offset+bufSamples]
+		outR := a.state.out[1][offset : offset+bufSamples]
+		for i := range outL {
+			outL[i] = 0
+			outR[i] = 0
 		}
-		writeBuffer(a.state.out, offset, buf, 0)
-		writeBuffer(a.state.out, offset, buf, 1)
-		a.state.pos += bufSamples
-		a.state.lastRead = timestamp
-		eventLength := len(a.state.events)
-		for i := 0; i < eventLength; i++ {
-			if i >= eventLength/2 {
-				a.state.events[i-eventLength/2] = a.state.events[i]
+		a.state.scheduler.process(int(bufSamples), a.receiveMidi)
+		a.state.transport.process(int(bufSamples), a.receiveGeneratedMidi)
+		bpm := a.state.clock.bpm(timestamp)
+		for _, p := range a.state.parts {
+			if p.mix.enabled {
+				partL := p.out[0][:bufSamples]
+				partR := p.out[1][:bufSamples]
+				p.calc(bpm, a.state.tuning, partL, partR, a.sendGeneratedMidi)
+				gainL, gainR := p.mix.gains()
+				for i := range partL {
+					outL[i] += partL[i] * gainL
+					outR[i] += partR[i] * gainR
+				}
+				p.running = true
+			} else if p.running {
+				// voices of a disabled part stop receiving note-offs, so silence them
+				p.events[0] = append(p.events[0], &midiEvent{channel: channelOmni, event: &controlChange{number: ccAllSoundOff}})
+				p.calc(bpm, a.state.tuning, p.out[0][:bufSamples], p.out[1][:bufSamples], a.sendGeneratedMidi)
+				p.running = false
 			}
-			a.state.events[i] = nil
+			p.shiftEvents()
 		}
+		writeBuffer(a.state.out[0], offset, buf, 0)
+		writeBuffer(a.state.out[1], offset, buf, 1)
+		a.state.pos += bufSamples
+		a.state.lastRead = timestamp
 		endTime := now()
 		a.state.processTime = endTime - timestamp
 		if a.state.processTime > responseDelay {
 			log.Printf("[WARN] time budget exceeded: processTime=%dms, activeNotes=%d\n",
-				int(a.state.processTime*1000), len(a.state.polyOsc.active))
+				int(a.state.processTime*1000), a.state.polyphony())
 		} else {
 			// log.Printf("%.2fms\n", a.state.processTime*1000)
 		}
-		// log.Println(len(a.state.polyOsc.active))
+		// log.Println(a.state.polyphony())
 		return len(buf), nil // io.EOF, etc.
 	}
 }
@@ -263,6 +366,7 @@ func NewAudio(presetDir string) (*Audio, error) {
 		otoContext:    otoContext,
 		presetManager: newPresetManager(presetDir),
 		CommandCh:     commandCh,
+		MidiOutCh:     make(chan []byte, 1024),
 		state:         newState(),
 		Changes: &Changes{
 			dict: make(map[string]struct{}),
@@ -286,35 +390,156 @@ func processCommands(audio *Audio, commandCh <-chan []string) {
 func (a *Audio) update(command []string) error {
 	switch command[0] {
 	case "set":
+		command = command[1:]
+		// loads files before blocking the audio thread
+		// (errors on user files are logged instead of being fatal)
+		if len(command) >= 2 && command[len(command)-1] != "" {
+			path := command[len(command)-1]
+			var err error
+			switch command[len(command)-2] {
+			case "sfz":
+				_, err = loadSampleInstrument(path)
+			case "wavetable":
+				_, err = loadUserWavetable(path)
+			}
+			if err != nil {
+				log.Printf("failed to load %v: %v\n", path, err)
+				return nil
+			}
+		}
 		a.state.Lock()
 		defer a.state.Unlock()
-		command = command[1:]
+		p := a.state.selectedPart()
+		if command[0] == "part" {
+			index, err := parsePartIndex(command[1])
+			if err != nil {
+				return err
+			}
+			p = a.state.parts[index]
+			command = command[2:]
+		}
 		switch command[0] {
+		case "mix":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.mix.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
 		case "glide_time":
 			command = command[1:]
 			value, err := strconv.ParseInt(command[0], 10, 64)
 			if err != nil {
 				return err
 			}
-			a.state.glideTime = int(value)
+			p.glideParams.time = int(value)
 		case "vel_sense":
 			command = command[1:]
 			value, err := strconv.ParseFloat(command[0], 64)
 			if err != nil {
 				return err
 			}
-			a.state.velSense = value
+			p.velSense = value
+		case "unison":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.unisonParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "mono":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.monoParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "glide":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.glideParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "velocity":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.velocityParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "osc_count":
+			command = command[1:]
+			value, err := strconv.ParseInt(command[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			err = p.setOscCount(int(value))
+			if err != nil {
+				return err
+			}
 		case "osc":
 			command = command[1:]
-			index, err := strconv.ParseInt(command[0], 10, 64)
+			index, err := parseIndex(command[0], len(p.oscParams))
+			if err != nil {
+				return err
+			}
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err = p.oscParams[index].set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "osc_partial":
+			command = command[1:]
+			if len(command) != 3 {
+				return fmt.Errorf("invalid partial %v", command)
+			}
+			index, err := parseIndex(command[0], len(p.oscParams))
+			if err != nil {
+				return err
+			}
+			n, err := parseIndex(command[1], maxPartials)
 			if err != nil {
 				return err
 			}
+			value, err := strconv.ParseFloat(command[2], 64)
+			if err != nil {
+				return err
+			}
+			p.oscParams[index].additive.partials[n] = value
+		case "fm":
 			command = command[1:]
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err = a.state.oscParams[index].set(command[0], command[1])
+			err := p.fmParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "fm_op":
+			command = command[1:]
+			index, err := parseIndex(command[0], len(p.fmParams.operators))
+			if err != nil {
+				return err
+			}
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err = p.fmParams.operators[index].set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -323,7 +548,7 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err := a.state.adsrParams.set(command[0], command[1])
+			err := p.adsrParams.set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -332,7 +557,7 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err := a.state.noteFilterParams.set(command[0], command[1])
+			err := p.noteFilterParams.set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -342,7 +567,7 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err := a.state.filterParams.set(command[0], command[1])
+			err := p.filterParams.set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -352,7 +577,7 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err := a.state.formantParams.set(command[0], command[1])
+			err := p.formantParams.set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -367,7 +592,7 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err = a.state.lfoParams[index].set(command[0], command[1])
+			err = p.lfoParams[index].set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -381,7 +606,34 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err = a.state.envelopeParams[index].set(command[0], command[1])
+			err = p.envelopeParams[index].set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "expression":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.expressionParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "sequencer":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.seqParams.set(command[0], command[1])
+			if err != nil {
+				return err
+			}
+		case "arpeggiator":
+			command = command[1:]
+			if len(command) != 2 {
+				return fmt.Errorf("invalid key-value pair %v", command)
+			}
+			err := p.arpParams.set(command[0], command[1])
 			if err != nil {
 				return err
 			}
@@ -390,38 +642,112 @@ func (a *Audio) update(command []string) error {
 			if len(command) != 2 {
 				return fmt.Errorf("invalid key-value pair %v", command)
 			}
-			err := a.state.echoParams.set(command[0], command[1])
+			err := p.echoParams.set(command[0], command[1])
 			if err != nil {
 				return err
 			}
 		}
+		a.sendControlFeedback()
 		a.Changes.Add("data")
 	case "mono":
 		a.state.Lock()
 		defer a.state.Unlock()
-		a.state.polyMode = false
+		a.state.selectedPart().polyMode = false
 		a.Changes.Add("data")
 	case "poly":
 		a.state.Lock()
 		defer a.state.Unlock()
-		a.state.polyMode = true
+		a.state.selectedPart().polyMode = true
 		a.Changes.Add("data")
+	case "part":
+		command = command[1:]
+		switch command[0] {
+		case "select":
+			a.state.Lock()
+			defer a.state.Unlock()
+			index, err := parsePartIndex(command[1])
+			if err != nil {
+				return err
+			}
+			a.state.selected = index
+			a.Changes.Add("all_params")
+			a.Changes.Add("filter-shape")
+			a.Changes.Add("data")
+		}
 	case "note_on":
+		// note_on <note> [velocity] [channel]
+		note, err := parseMidiValue(command, 1, 0, 127, -1)
+		if err != nil {
+			return err
+		}
+		velocity, err := parseMidiValue(command, 2, 1, 127, 127)
+		if err != nil {
+			return err
+		}
+		channel, err := parseMidiValue(command, 3, 1, 16, 1)
+		if err != nil {
+			return err
+		}
 		a.state.Lock()
 		defer a.state.Unlock()
-		note, err := strconv.ParseInt(command[1], 10, 32)
+		a.receiveMidi(a.currentEventIndex(), []byte{0x90 | byte(channel-1), byte(note), byte(velocity)})
+	case "note_off":
+		// note_off <note> [channel] [velocity]
+		note, err := parseMidiValue(command, 1, 0, 127, -1)
+		if err != nil {
+			return err
+		}
+		channel, err := parseMidiValue(command, 2, 1, 16, 1)
+		if err != nil {
+			return err
+		}
+		velocity, err := parseMidiValue(command, 3, 0, 127, defaultReleaseVelocity)
 		if err != nil {
 			return err
 		}
-		a.addMidiEvent(&noteOn{note: int(note), velocity: 127})
-	case "note_off":
 		a.state.Lock()
 		defer a.state.Unlock()
-		note, err := strconv.ParseInt(command[1], 10, 32)
+		a.receiveMidi(a.currentEventIndex(), []byte{0x80 | byte(channel-1), byte(note), byte(velocity)})
+	case "note":
+		// note <note> <velocity> <duration_ms> [channel]
+		note, err := parseMidiValue(command, 1, 0, 127, -1)
+		if err != nil {
+			return err
+		}
+		velocity, err := parseMidiValue(command, 2, 1, 127, -1)
 		if err != nil {
 			return err
 		}
-		a.addMidiEvent(&noteOff{note: int(note)})
+		if len(command) < 4 {
+			return fmt.Errorf("duration is required")
+		}
+		duration, err := strconv.ParseFloat(command[3], 64)
+		if err != nil {
+			return err
+		}
+		if duration < 0 {
+			return fmt.Errorf("invalid duration %v", command[3])
+		}
+		channel, err := parseMidiValue(command, 4, 1, 16, 1)
+		if err != nil {
+			return err
+		}
+		a.state.Lock()
+		defer a.state.Unlock()
+		index := a.currentEventIndex()
+		status := byte(channel - 1)
+		a.receiveMidi(index, []byte{0x90 | status, byte(note), byte(velocity)})
+		a.state.scheduler.add(index+int(duration/1000*sampleRate), []byte{0x80 | status, byte(note), defaultReleaseVelocity})
+	case "all_notes_off":
+		a.state.Lock()
+		defer a.state.Unlock()
+		a.state.scheduler.clear()
+		a.addMidiEventToAllParts(a.currentEventIndex(), &controlChange{number: ccAllNotesOff})
+	case "all_sound_off":
+		a.state.Lock()
+		defer a.state.Unlock()
+		a.state.scheduler.clear()
+		a.addMidiEventToAllParts(a.currentEventIndex(), &controlChange{number: ccAllSoundOff})
 	case "preset":
 		command = command[1:]
 		switch command[0] {
@@ -436,13 +762,24 @@ func (a *Audio) update(command []string) error {
 			if !exists {
 				return fmt.Errorf("preset \"" + name + "\" does not exist")
 			}
-			err = a.presetManager.applyToParams(name, a.state.params)
+			data, err := a.presetManager.readParams(name)
 			if err != nil {
 				return err
 			}
+			preloadParamsFiles(data)
+			a.state.Lock()
+			defer a.state.Unlock()
+			p := a.state.selectedPart()
+			p.params.applyJSON(data)
+			p.preset = name
+			a.sendControlFeedback()
 			a.Changes.Add("all_params")
+			a.Changes.Add("data")
 		case "save":
-			listUpdated, err := a.presetManager.overrideParams(a.state.params)
+			a.state.Lock()
+			defer a.state.Unlock()
+			p := a.state.selectedPart()
+			listUpdated, err := a.presetManager.overrideParams(p.preset, p.params)
 			if err != nil {
 				return err
 			}
@@ -451,10 +788,16 @@ func (a *Audio) update(command []string) error {
 			}
 		case "save_as":
 			name := command[1]
-			listUpdated, err := a.presetManager.saveParams(name, a.state.params)
+			a.state.Lock()
+			defer a.state.Unlock()
+			p := a.state.selectedPart()
+			listUpdated, err := a.presetManager.saveParams(name, p.params)
 			if err != nil {
 				return err
 			}
+			p.preset = name
+			a.Changes.Add("all_params")
+			a.Changes.Add("data")
 			if listUpdated {
 				a.Changes.Add("preset_list")
 			}
@@ -468,27 +811,418 @@ func (a *Audio) update(command []string) error {
 				a.Changes.Add("preset_list")
 			}
 		}
+	case "sf2":
+		command = command[1:]
+		switch command[0] {
+		case "list":
+			// sf2 list <path>
+			if len(command) != 2 {
+				return fmt.Errorf("path is required")
+			}
+			sf, err := loadSoundFont(command[1])
+			if err != nil {
+				log.Printf("failed to load %v: %v\n", command[1], err)
+				return nil
+			}
+			a.state.Lock()
+			defer a.state.Unlock()
+			a.sf2List = sf.listToJSON(command[1])
+			a.Changes.Add("sf2_list")
+		case "load":
+			// sf2 load <path> <bank> <program>
+			if len(command) != 4 {
+				return fmt.Errorf("path, bank and program are required")
+			}
+			bank, err := strconv.ParseInt(command[2], 10, 64)
+			if err != nil {
+				return err
+			}
+			program, err := strconv.ParseInt(command[3], 10, 64)
+			if err != nil {
+				return err
+			}
+			_, err = loadSoundFont(command[1])
+			if err != nil {
+				log.Printf("failed to load %v: %v\n", command[1], err)
+				return nil
+			}
+			a.state.Lock()
+			defer a.state.Unlock()
+			p := a.state.selectedPart()
+			err = p.applySF2Preset(command[1], int(bank), int(program))
+			if err != nil {
+				log.Printf("failed to load %v: %v\n", command[1], err)
+				return nil
+			}
+			p.preset = ""
+			a.sendControlFeedback()
+			a.Changes.Add("all_params")
+			a.Changes.Add("filter-shape")
+			a.Changes.Add("data")
+		}
+	case "tempo":
+		bpm, err := strconv.ParseFloat(command[1], 64)
+		if err != nil {
+			return err
+		}
+		if bpm <= 0 {
+			return fmt.Errorf("invalid tempo %v", command[1])
+		}
+		a.state.Lock()
+		defer a.state.Unlock()
+		a.state.clock.internalBpm = bpm
+	case "transport":
+		command = command[1:]
+		switch command[0] {
+		case "load":
+			file := command[1]
+			song, err := loadSMF(file)
+			if err != nil {
+				log.Printf("failed to load %v: %v\n", file, err)
+				return nil
+			}
+			a.state.Lock()
+			defer a.state.Unlock()
+			a.state.transport.load(file, song, a.receiveGeneratedMidi)
+		case "play":
+			a.state.Lock()
+			defer a.state.Unlock()
+			err := a.state.transport.play()
+			if err != nil {
+				return err
+			}
+		case "stop":
+			a.state.Lock()
+			defer a.state.Unlock()
+			a.state.transport.stop(a.receiveGeneratedMidi)
+		case "seek":
+			beat, err := strconv.ParseFloat(command[1], 64)
+			if err != nil {
+				return err
+			}
+			a.state.Lock()
+			defer a.state.Unlock()
+			err = a.state.transport.seekBeat(beat, a.receiveGeneratedMidi)
+			if err != nil {
+				return err
+			}
+		case "loop":
+			a.state.Lock()
+			defer a.state.Unlock()
+			if command[1] == "off" {
+				a.state.transport.clearLoop()
+				break
+			}
+			if len(command) != 3 {
+				return fmt.Errorf("invalid loop range %v", command[1:])
+			}
+			start, err := strconv.ParseFloat(command[1], 64)
+			if err != nil {
+				return err
+			}
+			end, err := strconv.ParseFloat(command[2], 64)
+			if err != nil {
+				return err
+			}
+			err = a.state.transport.setLoop(start, end)
+			if err != nil {
+				return err
+			}
+		}
+	case "sequencer":
+		a.state.Lock()
+		defer a.state.Unlock()
+		command = command[1:]
+		p := a.state.selectedPart()
+		if command[0] == "part" {
+			index, err := parsePartIndex(command[1])
+			if err != nil {
+				return err
+			}
+			p = a.state.parts[index]
+			command = command[2:]
+		}
+		err := a.updateSequencer(p, command)
+		if err != nil {
+			return err
+		}
+	case "program_map":
+		command = command[1:]
+		switch command[0] {
+		case "list":
+			a.Changes.Add("program_map")
+		case "set":
+			if len(command) != 4 {
+				return fmt.Errorf("invalid program map entry %v", command[1:])
+			}
+			bank, program, err := parseBankAndProgram(command[1], command[2])
+			if err != nil {
+				return err
+			}
+			name := command[3]
+			exists, err := a.presetManager.existsInList(name)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("preset \"" + name + "\" does not exist")
+			}
+			err = a.presetManager.setProgram(bank, program, name)
+			if err != nil {
+				return err
+			}
+			a.Changes.Add("program_map")
+		case "remove":
+			if len(command) != 3 {
+				return fmt.Errorf("invalid program map entry %v", command[1:])
+			}
+			bank, program, err := parseBankAndProgram(command[1], command[2])
+			if err != nil {
+				return err
+			}
+			err = a.presetManager.removeProgram(bank, program)
+			if err != nil {
+				return err
+			}
+			a.Changes.Add("program_map")
+		}
+	case "tuning":
+		if len(command) < 2 || (command[1] != "reset" && len(command) != 3) {
+			return fmt.Errorf("invalid tuning command %v", command[1:])
+		}
+		// loads files before blocking the audio thread
+		var loaded *tuning
+		var err error
+		switch command[1] {
+		case "scl":
+			loaded, err = loadScale(command[2])
+		case "kbm":
+			loaded, err = loadMapping(command[2])
+		}
+		if err != nil {
+			log.Printf("failed to load %v: %v\n", command[2], err)
+			return nil
+		}
+		a.state.Lock()
+		defer a.state.Unlock()
+		switch command[1] {
+		case "reference":
+			// tuning reference <hz>
+			freq, err := strconv.ParseFloat(command[2], 64)
+			if err != nil {
+				return err
+			}
+			err = a.state.tuning.setReferenceFreq(freq)
+			if err != nil {
+				return err
+			}
+		case "scl":
+			// tuning scl <path>
+			a.state.tuning.applyScale(loaded)
+		case "kbm":
+			// tuning kbm <path>
+			a.state.tuning.applyMapping(loaded)
+		case "reset":
+			a.state.tuning = newTuning()
+		default:
+			return fmt.Errorf("unknown tuning command %v", command[1])
+		}
+		a.Changes.Add("tuning")
+		a.Changes.Add("data")
+	case "midi":
+		a.state.Lock()
+		defer a.state.Unlock()
+		command = command[1:]
+		switch command[0] {
+		case "thru":
+			a.state.midi.thru = command[1] == "true"
+		case "generated":
+			a.state.midi.generated = command[1] == "true"
+		case "mpe":
+			// midi mpe <lower|upper> <key> <value>
+			if len(command) != 4 {
+				return fmt.Errorf("invalid MPE setting %v", command[1:])
+			}
+			err := a.state.midi.mpe.set(command[1], command[2], command[3])
+			if err != nil {
+				return err
+			}
+		case "map":
+			// midi map <cc> <min> <max> [part <n>] <path...>
+			if len(command) < 5 {
+				return fmt.Errorf("invalid CC mapping %v", command[1:])
+			}
+			number, err := strconv.ParseInt(command[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			min, err := strconv.ParseFloat(command[2], 64)
+			if err != nil {
+				return err
+			}
+			max, err := strconv.ParseFloat(command[3], 64)
+			if err != nil {
+				return err
+			}
+			command = command[4:]
+			index := a.state.selected
+			if command[0] == "part" && len(command) > 2 {
+				index, err = parsePartIndex(command[1])
+				if err != nil {
+					return err
+				}
+				command = command[2:]
+			}
+			path := append([]string{}, command...)
+			_, err = a.state.parts[index].continuousParam(path)
+			if err != nil {
+				return err
+			}
+			m, err := newCCMapping(index, int(number), path, min, max)
+			if err != nil {
+				return err
+			}
+			a.state.midi.addMapping(m)
+			a.sendControlFeedback()
+		case "unmap":
+			// midi unmap <cc> [part <n>]
+			number, err := strconv.ParseInt(command[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			index := a.state.selected
+			if len(command) == 4 && command[2] == "part" {
+				index, err = parsePartIndex(command[3])
+				if err != nil {
+					return err
+				}
+			}
+			a.state.midi.removeMapping(index, int(number))
+		case "list":
+		default:
+			return fmt.Errorf("unknown MIDI command %v", command[0])
+		}
+		a.Changes.Add("midi_settings")
+		a.Changes.Add("data")
 	default:
 		return fmt.Errorf("unknown command %v", command[0])
 	}
 	return nil
 }
 
+func (a *Audio) updateSequencer(p *part, command []string) error {
+	s := p.seqParams
+	switch command[0] {
+	case "play":
+		for _, p := range a.state.parts {
+			p.seq.start()
+		}
+		return nil
+	case "stop":
+		for _, p := range a.state.parts {
+			p.seq.stop()
+		}
+		return nil
+	case "add_pattern":
+		err := s.addPattern()
+		if err != nil {
+			return err
+		}
+	case "remove_pattern":
+		index, err := parseIndex(command[1], len(s.patterns))
+		if err != nil {
+			return err
+		}
+		err = s.removePattern(index)
+		if err != nil {
+			return err
+		}
+	case "length":
+		// sequencer length <pattern> <length>
+		if len(command) != 3 {
+			return fmt.Errorf("invalid pattern length %v", command[1:])
+		}
+		index, err := parseIndex(command[1], len(s.patterns))
+		if err != nil {
+			return err
+		}
+		err = s.patterns[index].setLength(command[2])
+		if err != nil {
+			return err
+		}
+	case "step", "lock", "unlock":
+		// sequencer step <pattern> <step> <key> <value>
+		// sequencer lock <pattern> <step> <value> <path...>
+		// sequencer unlock <pattern> <step> <path...>
+		if len(command) < 4 {
+			return fmt.Errorf("invalid step command %v", command)
+		}
+		index, err := parseIndex(command[1], len(s.patterns))
+		if err != nil {
+			return err
+		}
+		pattern := s.patterns[index]
+		stepIndex, err := parseIndex(command[2], pattern.length)
+		if err != nil {
+			return err
+		}
+		step := pattern.steps[stepIndex]
+		switch command[0] {
+		case "step":
+			if len(command) != 5 {
+				return fmt.Errorf("invalid key-value pair %v", command[3:])
+			}
+			err = step.set(command[3], command[4])
+			if err != nil {
+				return err
+			}
+		case "lock":
+			value, err := strconv.ParseFloat(command[3], 64)
+			if err != nil {
+				return err
+			}
+			path := append([]string{}, command[4:]...)
+			_, err = p.params.continuousParam(path)
+			if err != nil {
+				return err
+			}
+			step.lock(path, value)
+		case "unlock":
+			step.unlock(command[3:])
+		}
+	default:
+		return fmt.Errorf("unknown sequencer command %v", command[0])
+	}
+	a.Changes.Add("all_params")
+	a.Changes.Add("data")
+	return nil
+}
+
 // RestoreLastParams ...
 func (a *Audio) RestoreLastParams() error {
 	a.state.Lock() // TODO: too long lock
 	defer a.state.Unlock()
-	found, err := a.presetManager.restoreLastParams(a.state.params)
+	found, err := a.presetManager.restoreLastSession(a.state)
 	if err != nil {
 		return err
 	}
+	if !found {
+		// fallback to the data saved before multitimbral parts were introduced
+		found, err = a.presetManager.restoreLastParams(a.state.parts[0].params)
+		if err != nil {
+			return err
+		}
+	}
 	if found {
+		a.sendControlFeedback()
 		log.Println("loaded temporary file in ", a.presetManager.dir)
 	} else {
 		log.Println("temporary file not found in ", a.presetManager.dir)
 	}
 	a.Changes.Add("all_params")
 	a.Changes.Add("preset_list")
+	a.Changes.Add("midi_settings")
+	a.Changes.Add("tuning")
 	return nil
 }
 
@@ -496,7 +1230,7 @@ func (a *Audio) RestoreLastParams() error {
 func (a *Audio) SaveTemporaryData() error {
 	a.state.Lock() // TODO: too long lock
 	defer a.state.Unlock()
-	err := a.presetManager.saveTemporaryParams(a.state.params)
+	err := a.presetManager.saveTemporarySession(a.state)
 	if err != nil {
 		return err
 	}
@@ -530,7 +1264,9 @@ func (a *Audio) Start(ctx context.Context) error {
 }
 
 type allParamsJSON struct {
+	Part   int             `json:"part"`
 	Name   *string         `json:"name"`
+	Mix    json.RawMessage `json:"mix"`
 	Params json.RawMessage `json:"params"`
 }
 
@@ -538,14 +1274,17 @@ type allParamsJSON struct {
 func (a *Audio) GetParamsJSON() json.RawMessage {
 	a.state.Lock()
 	defer a.state.Unlock()
+	p := a.state.selectedPart()
 	var nameOrNull *string
-	name := a.presetManager.selected
+	name := p.preset
 	if name != "" {
 		nameOrNull = &name
 	}
 	return toRawMessage(&allParamsJSON{
+		Part:   a.state.selected,
 		Name:   nameOrNull,
-		Params: a.state.params.toJSON(),
+		Mix:    p.mix.toJSON(),
+		Params: p.params.toJSON(),
 	})
 }
 
@@ -554,16 +1293,43 @@ func (a *Audio) GetPresetListJSON() (json.RawMessage, error) {
 	return a.presetManager.listToJSON()
 }
 
+// GetSF2ListJSON returns presets of the SF2 file listed last
+func (a *Audio) GetSF2ListJSON() json.RawMessage {
+	a.state.Lock()
+	defer a.state.Unlock()
+	return a.sf2List
+}
+
+// GetProgramMapJSON ...
+func (a *Audio) GetProgramMapJSON() (json.RawMessage, error) {
+	return a.presetManager.programMapToJSON()
+}
+
+// GetTuningJSON ...
+func (a *Audio) GetTuningJSON() json.RawMessage {
+	a.state.Lock()
+	defer a.state.Unlock()
+	return a.state.tuning.toJSON()
+}
+
+// GetMidiSettingsJSON ...
+func (a *Audio) GetMidiSettingsJSON() json.RawMessage {
+	a.state.Lock()
+	defer a.state.Unlock()
+	return a.state.midi.toJSON()
+}
+
 var filterShapeFeedforward = []float64{}
 var filterShapeFeedback = []float64{}
 
 // GetFilterShape ...
 func (a *Audio) GetFilterShape() []float64 {
 	a.state.Lock()
+	p := a.state.selectedPart()
 	filter := newFilter()
-	filter.applyParams(a.state.filterParams)
+	filter.applyParams(p.filterParams)
 	formant := newFormant()
-	formant.applyParams(a.state.formantParams)
+	formant.applyParams(p.formantParams)
 	a.state.Unlock()
 
 	out := make([]float64, fftSize)
@@ -579,16 +1345,22 @@ func (a *Audio) GetFilterShape() []float64 {
 }
 
 type statusJSON struct {
-	Polyphony   int     `json:"polyphony"`
-	ProcessTime float64 `json:"processTime"`
+	Polyphony   int            `json:"polyphony"`
+	ProcessTime float64        `json:"processTime"`
+	Transport   *transportJSON `json:"transport"`
+	Clock       *clockJSON     `json:"clock"`
+	Sequencer   *sequencerJSON `json:"sequencer"`
 }
 
 // GetStatusJSON ...
 func (a *Audio) GetStatusJSON() []byte {
 	a.state.Lock()
 	statusJSON := &statusJSON{
-		Polyphony:   len(a.state.polyOsc.active),
+		Polyphony:   a.state.polyphony(),
 		ProcessTime: a.state.processTime,
+		Transport:   a.state.transport.toJSON(),
+		Clock:       a.state.clock.toJSON(now()),
+		Sequencer:   a.state.selectedPart().seq.toJSON(),
 	}
 	a.state.Unlock()
 	bytes, err := json.Marshal(statusJSON)
@@ -606,8 +1378,10 @@ func (a *Audio) GetFFT() []float64 {
 	// fftResult: | 1 | 2 | 3 | 4 |
 	// return:    |<----->|
 	offset := a.state.pos % fftSize
-	copy(a.fftResult, a.state.out[offset:])
-	copy(a.fftResult[fftSize-offset:], a.state.out[:offset])
+	for i := int64(0); i < fftSize; i++ {
+		j := (offset + i) % fftSize
+		a.fftResult[i] = (a.state.out[0][j] + a.state.out[1][j]) / 2
+	}
 	a.state.Unlock()
 	applyWindow(a.fftResult, han)
 	fft.CalcAbs(a.fftResult)
@@ -619,30 +1393,257 @@ func (a *Audio) GetFFT() []float64 {
 
 // AddMidiEvent ...
 func (a *Audio) AddMidiEvent(data []byte) {
+	if data[0]>>4 == 12 && len(data) >= 2 {
+		a.preloadProgram(int(data[0]&0x0f), int(data[1]))
+	}
 	a.state.Lock()
 	defer a.state.Unlock()
+	if a.state.midi.thru {
+		a.sendMidi(data)
+	}
+	switch data[0] {
+	case 0xf8: // timing clock
+		a.state.clock.tick(now())
+		return
+	case 0xfa: // start
+		log.Println("got MIDI start")
+		a.state.clock.start()
+		for _, p := range a.state.parts {
+			p.seq.start()
+		}
+		if a.state.transport.song != nil {
+			// notes held by the transport are released before restarting
+			a.state.transport.seekBeat(0, a.receiveGeneratedMidi)
+			a.state.transport.playing = true
+		}
+		return
+	case 0xfb: // continue
+		log.Println("got MIDI continue")
+		a.state.clock.start()
+		for _, p := range a.state.parts {
+			p.seq.playing = true
+		}
+		if a.state.transport.song != nil {
+			a.state.transport.playing = true
+		}
+		return
+	case 0xfc: // stop
+		log.Println("got MIDI stop")
+		a.state.clock.stop()
+		a.state.transport.stop(a.receiveGeneratedMidi)
+		for _, p := range a.state.parts {
+			p.seq.stop()
+		}
+		return
+	}
+	a.receiveMidi(a.currentEventIndex(), data)
+}
+
+// also used for the messages generated inside the engine
+func (a *Audio) receiveMidi(index int, data []byte) {
+	channel := int(data[0] & 0x0f)
 	if data[0]>>4 == 8 || data[0]>>4 == 9 && data[2] == 0 {
-		log.Printf("got note-off: %v\n", data)
 		note := int(data[1])
-		a.addMidiEvent(&noteOff{note: note})
+		velocity := defaultReleaseVelocity // note-on with velocity 0 has no release velocity
+		if data[0]>>4 == 8 {
+			velocity = int(data[2])
+		}
+		a.addMidiEventAt(index, channel, &noteOff{note: note, velocity: velocity})
 	} else if data[0]>>4 == 9 && data[2] > 0 {
-		log.Printf("got note-on: %v\n", data)
 		note := int(data[1])
 		velocity := int(data[2])
-		a.addMidiEvent(&noteOn{note: note, velocity: velocity})
+		a.addMidiEventAt(index, channel, &noteOn{note: note, velocity: velocity})
+	} else if data[0]>>4 == 10 {
+		note := int(data[1])
+		value := float64(data[2]) / 127
+		a.addMidiEventAt(index, channel, &polyPressure{note: note, value: value})
+	} else if data[0]>>4 == 11 {
+		number := int(data[1])
+		value := int(data[2])
+		if a.state.midi.mpe.controlChange(channel, number, value) {
+			a.Changes.Add("midi_settings")
+		}
+		switch number {
+		case ccBankSelectMSB, ccBankSelectLSB:
+			for _, p := range a.state.parts {
+				if p.mix.accepts(channel) {
+					p.selectBank(number, value)
+				}
+			}
+		default:
+			a.receiveMappedCC(channel, number, value)
+			a.addMidiEventAt(index, channel, &controlChange{number: number, value: value})
+		}
+	} else if data[0]>>4 == 12 {
+		program := int(data[1])
+		for _, p := range a.state.parts {
+			if p.mix.accepts(channel) {
+				err := a.changeProgram(p, program)
+				if err != nil {
+					log.Printf("failed to change program: %v\n", err)
+				}
+			}
+		}
+	} else if data[0]>>4 == 13 {
+		value := float64(data[1]) / 127
+		a.addMidiEventAt(index, channel, &channelPressure{value: value})
+	} else if data[0]>>4 == 14 {
+		value := int(data[1]) | int(data[2])<<7
+		semitones, master := a.state.midi.mpe.pitchBend(channel, value)
+		a.addMidiEventAt(index, channel, &pitchBend{semitones: semitones, master: master})
 	}
 }
 
-func (a *Audio) addMidiEvent(event interface{}) {
+// loads files of the presets selected by a program change before locking the state for changeProgram()
+func (a *Audio) preloadProgram(channel int, program int) {
+	a.state.Lock()
+	banks := make([]int, 0, len(a.state.parts))
+	for _, p := range a.state.parts {
+		if p.mix.accepts(channel) {
+			banks = append(banks, p.bank())
+		}
+	}
+	a.state.Unlock()
+	for _, bank := range banks {
+		name, err := a.presetManager.resolveProgram(bank, program)
+		if err != nil || name == "" {
+			continue
+		}
+		data, err := a.presetManager.readParams(name)
+		if err != nil {
+			continue
+		}
+		preloadParamsFiles(data)
+	}
+}
+
+func (a *Audio) changeProgram(p *part, program int) error {
+	name, err := a.presetManager.resolveProgram(p.bank(), program)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		log.Printf("no preset for bank %v program %v\n", p.bank(), program)
+		return nil
+	}
+	err = a.presetManager.applyToParams(name, p.params)
+	if err != nil {
+		return err
+	}
+	p.preset = name
+	a.sendControlFeedback()
+	a.Changes.Add("all_params")
+	a.Changes.Add("filter-shape")
+	a.Changes.Add("data")
+	return nil
+}
+
+// notes played by the transport (or any other generator) can also drive external instruments
+func (a *Audio) receiveGeneratedMidi(index int, data []byte) {
+	a.sendGeneratedMidi(data)
+	// program changes and bank selects in songs are ignored
+	// so that the current (maybe unsaved) params can be auditioned against them
+	if isProgramOrBankChange(data) {
+		return
+	}
+	a.receiveMidi(index, data)
+}
+
+func isProgramOrBankChange(data []byte) bool {
+	if data[0]>>4 == 12 {
+		return true
+	}
+	return data[0]>>4 == 11 && (data[1] == ccBankSelectMSB || data[1] == ccBankSelectLSB)
+}
+
+func (a *Audio) sendGeneratedMidi(data []byte) {
+	if a.state.midi.generated {
+		a.sendMidi(data)
+	}
+}
+
+func (a *Audio) sendMidi(data []byte) {
+	select {
+	case a.MidiOutCh <- data:
+	default:
+		log.Println("[WARN] MIDI OUT buffer is full")
+	}
+}
+
+// ----- CC Mapping ----- //
+
+func (a *Audio) receiveMappedCC(channel int, number int, value int) {
+	for _, m := range a.state.midi.ccMappings {
+		p := a.state.parts[m.part]
+		if m.number != number || !p.mix.accepts(channel) {
+			continue
+		}
+		target, err := p.continuousParam(m.path)
+		if err != nil {
+			log.Printf("failed to apply CC: %v\n", err)
+			continue
+		}
+		*target = m.toValue(value)
+		m.lastValue = value
+		a.Changes.Add("all_params")
+		a.Changes.Add("filter-shape")
+		a.Changes.Add("data")
+	}
+}
+
+// sends the current values so that motorized faders and LED rings follow parameter changes
+func (a *Audio) sendControlFeedback() {
+	for _, m := range a.state.midi.ccMappings {
+		p := a.state.parts[m.part]
+		target, err := p.continuousParam(m.path)
+		if err != nil {
+			continue
+		}
+		value := m.toCC(*target)
+		if value == m.lastValue {
+			continue
+		}
+		m.lastValue = value
+		channel := p.mix.channel
+		if channel == channelOmni {
+			channel = 0
+		}
+		a.sendMidi([]byte{0xb0 | byte(channel), byte(m.number), byte(value)})
+	}
+}
+
+func (a *Audio) currentEventIndex() int {
 	offset := now() - a.state.lastRead
 	index := int(offset / secPerSample)
 	if index < 0 {
 		log.Println("[WARN] index < 0")
 		index = 0
 	}
-	if index >= len(a.state.events) {
+	if index >= samplesPerCycle*2 {
 		log.Println("[WARN] index >= event length")
-		index = len(a.state.events) - 1
+		index = samplesPerCycle*2 - 1
+	}
+	return index
+}
+func (a *Audio) addMidiEvent(channel int, event interface{}) {
+	a.addMidiEventAt(a.currentEventIndex(), channel, event)
+}
+
+// for panic commands that should reach every part
+func (a *Audio) addMidiEventToAllParts(index int, event interface{}) {
+	offset := float64(index) * secPerSample
+	e := &midiEvent{offset: offset, channel: channelOmni, event: event}
+	for _, p := range a.state.parts {
+		p.events[index] = append(p.events[index], e)
+	}
+}
+func (a *Audio) addMidiEventAt(index int, channel int, event interface{}) {
+	offset := float64(index) * secPerSample
+	e := &midiEvent{offset: offset, channel: channel, event: event}
+	routingChannel := a.state.midi.mpe.routingChannel(channel)
+	for _, p := range a.state.parts {
+		if p.mix.accepts(routingChannel) {
+			p.events[index] = append(p.events[index], e)
+		}
 	}
-	a.state.events[index] = append(a.state.events[index], &midiEvent{offset: offset, event: event})
 }
@@ -22,7 +22,7 @@ func benchmark(t *testing.T, audio *Audio, commands [][]string) {
 	_, err := audio.Read(out)
 	expectNoError(t, err)
 	for n := 0; n < polyphony; n++ {
-		audio.addMidiEvent(&noteOn{note: n})
+		audio.addMidiEvent(0, &noteOn{note: n})
 	}
 	start := now()
 	for n := 0; n < times; n++ {
@@ -71,3 +71,26 @@ func TestBenchmark(t *testing.T) {
 		{"set", "osc", "1", "kind", "square-wt"},
 	})
 }
+
+func TestDisablePart(t *testing.T) {
+	audio, err := NewAudio("work/preset")
+	expectNoError(t, err)
+	defer expectNoError(t, audio.Close())
+
+	out := make([]byte, bufferSizeInBytes)
+	expectNoError(t, audio.update([]string{"poly"}))
+	audio.addMidiEventAt(0, 0, &noteOn{note: 60, velocity: 100})
+	_, err = audio.Read(out)
+	expectNoError(t, err)
+	p := audio.state.parts[0]
+	expectEqual(t, len(p.polyOsc.active), 1)
+	// the note-off will not reach the disabled part
+	expectNoError(t, audio.update([]string{"set", "mix", "enabled", "false"}))
+	_, err = audio.Read(out)
+	expectNoError(t, err)
+	expectEqual(t, len(p.polyOsc.active), 0)
+	expectNoError(t, audio.update([]string{"set", "mix", "enabled", "true"}))
+	_, err = audio.Read(out)
+	expectNoError(t, err)
+	expectEqual(t, len(p.polyOsc.active), 0)
+}
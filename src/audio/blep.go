@@ -0,0 +1,54 @@
+package audio
+
+import "math"
+
+// ----- PolyBLEP ----- //
+
+// t: phase 0 ~ 1, dt: phase increment per sample
+// residual of a band-limited step (height 2) at t = 0
+func polyBlep(t float64, dt float64) float64 {
+	if t < dt {
+		t /= dt
+		return t + t - t*t - 1
+	} else if t > 1-dt {
+		t = (t - 1) / dt
+		return t*t + t + t + 1
+	}
+	return 0
+}
+
+// integral of polyBlep, for corners (multiply by slope change * dt / 2)
+func polyBlamp(t float64, dt float64) float64 {
+	if t < dt {
+		t = t/dt - 1
+		return -t * t * t / 3
+	} else if t > 1-dt {
+		t = (t-1)/dt + 1
+		return t * t * t / 3
+	}
+	return 0
+}
+func blSaw(t float64, dt float64) float64 {
+	return t*2 - 1 - polyBlep(t, dt)
+}
+
+// width: 0 ~ 1 (clamped to keep both edges apart)
+func blPulse(t float64, dt float64, width float64) float64 {
+	width = math.Max(0.01, math.Min(0.99, width))
+	value := -1.0
+	if t < width {
+		value = 1.0
+	}
+	value += polyBlep(t, dt)
+	value -= polyBlep(positiveMod(t-width, 1), dt)
+	return value
+}
+func blTriangle(t float64, dt float64) float64 {
+	value := 3 - t*4
+	if t < 0.5 {
+		value = t*4 - 1
+	}
+	value += 4 * dt * polyBlamp(t, dt)
+	value -= 4 * dt * polyBlamp(positiveMod(t-0.5, 1), dt)
+	return value
+}
@@ -0,0 +1,54 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolyBlep(t *testing.T) {
+	dt := 0.01
+	// same as naive waves away from edges
+	expectNearlyEqual(t, blSaw(0.3, dt), -0.4)
+	expectNearlyEqual(t, blPulse(0.3, dt, 0.5), 1)
+	expectNearlyEqual(t, blPulse(0.3, dt, 0.25), -1)
+	expectNearlyEqual(t, blTriangle(0.25, dt), 0)
+	// edges are smoothed to the midpoint
+	expectNearlyEqual(t, blSaw(0, dt), 0)
+	expectNearlyEqual(t, blPulse(0, dt, 0.5), 0)
+	expectNearlyEqual(t, blPulse(0.5, dt, 0.5), 0)
+	expectEqual(t, blTriangle(0, dt) > -1, true)
+	expectEqual(t, blTriangle(0.5, dt) < 1, true)
+	// symmetric around the edge
+	expectNearlyEqual(t, blSaw(1-dt/2, dt), -blSaw(dt/2, dt))
+	expectEqual(t, blSaw(1-dt/2, dt) < 0.9, true)
+	// width is clamped
+	expectNearlyEqual(t, blPulse(0.5, dt, 2), 1)
+}
+
+func TestPulseWidth(t *testing.T) {
+	p := newOscParams()
+	expectEqual(t, p.pulseWidth, defaultPulseWidth)
+	expectNoError(t, p.set("pulse_width", "0.5"))
+	expectEqual(t, *p.continuousParam("pulse_width"), 0.5)
+	p2 := newOscParams()
+	p2.applyJSON(p.toJSON())
+	expectEqual(t, p2.pulseWidth, 0.5)
+	p2.applyJSON([]byte(`{"enabled":true,"kind":"pulse"}`))
+	expectEqual(t, p2.pulseWidth, defaultPulseWidth)
+
+	// modulated by pulseWidthOffset
+	p.kind = wavePulse
+	p.enabled = true
+	p.pulseWidth = 0.25
+	o := newOsc(true)
+	o.initWithNote(p, newTuning(), 33, 127)
+	o.pulseWidthOffset = 0.5
+	positive := 0
+	for i := 0; i < sampleRate; i++ {
+		if o.step(1, 0) > 0 {
+			positive++
+		}
+	}
+	expectNearlyEqual(t, math.Round(float64(positive)/sampleRate*100)/100, 0.75)
+	expectEqual(t, destinationFromString("pulse_width"), destPulseWidth)
+}
@@ -0,0 +1,136 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+)
+
+// ----- CC Mapping ----- //
+
+type ccMapping struct {
+	part      int
+	number    int
+	path      []string // same as "set" commands
+	min       float64
+	max       float64
+	lastValue int // last CC value sent or received, -1 if unknown
+}
+
+type ccMappingJSON struct {
+	Part   int      `json:"part"`
+	Number int      `json:"number"`
+	Path   []string `json:"path"`
+	Min    float64  `json:"min"`
+	Max    float64  `json:"max"`
+}
+
+func newCCMapping(part int, number int, path []string, min float64, max float64) (*ccMapping, error) {
+	if number < 0 || number >= 128 {
+		return nil, fmt.Errorf("invalid CC number %v", number)
+	}
+	if min == max {
+		return nil, fmt.Errorf("min and max should be different")
+	}
+	return &ccMapping{
+		part:      part,
+		number:    number,
+		path:      path,
+		min:       min,
+		max:       max,
+		lastValue: -1,
+	}, nil
+}
+func (m *ccMapping) toValue(cc int) float64 {
+	return m.min + (m.max-m.min)*float64(cc)/127
+}
+func (m *ccMapping) toCC(value float64) int {
+	cc := int(math.Round((value - m.min) / (m.max - m.min) * 127))
+	if cc < 0 {
+		return 0
+	}
+	if cc > 127 {
+		return 127
+	}
+	return cc
+}
+
+// ----- MIDI Settings ----- //
+
+type midiSettings struct {
+	thru       bool // echo incoming messages to MIDI OUT
+	generated  bool // send notes generated inside the engine to MIDI OUT
+	ccMappings []*ccMapping
+	mpe        *mpeSettings
+}
+
+type midiSettingsJSON struct {
+	Thru       bool            `json:"thru"`
+	Generated  bool            `json:"generated"`
+	CCMappings []ccMappingJSON `json:"ccMappings"`
+	MPE        *mpeJSON        `json:"mpe"`
+}
+
+func newMidiSettings() *midiSettings {
+	return &midiSettings{
+		ccMappings: make([]*ccMapping, 0),
+		mpe:        newMpeSettings(),
+	}
+}
+func (s *midiSettings) applyJSON(data json.RawMessage) {
+	var j midiSettingsJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to midiSettings")
+		return
+	}
+	s.thru = j.Thru
+	s.generated = j.Generated
+	s.ccMappings = s.ccMappings[:0]
+	for _, item := range j.CCMappings {
+		if item.Part < 0 || item.Part >= maxParts {
+			log.Println("failed to apply JSON to ccMapping")
+			continue
+		}
+		m, err := newCCMapping(item.Part, item.Number, item.Path, item.Min, item.Max)
+		if err != nil {
+			log.Println("failed to apply JSON to ccMapping")
+			continue
+		}
+		s.ccMappings = append(s.ccMappings, m)
+	}
+	if j.MPE != nil {
+		s.mpe.applyJSON(j.MPE)
+	}
+}
+func (s *midiSettings) toJSON() json.RawMessage {
+	items := make([]ccMappingJSON, len(s.ccMappings))
+	for i, m := range s.ccMappings {
+		items[i] = ccMappingJSON{
+			Part:   m.part,
+			Number: m.number,
+			Path:   m.path,
+			Min:    m.min,
+			Max:    m.max,
+		}
+	}
+	return toRawMessage(&midiSettingsJSON{
+		Thru:       s.thru,
+		Generated:  s.generated,
+		CCMappings: items,
+		MPE:        s.mpe.toJSON(),
+	})
+}
+func (s *midiSettings) addMapping(m *ccMapping) {
+	s.removeMapping(m.part, m.number)
+	s.ccMappings = append(s.ccMappings, m)
+}
+func (s *midiSettings) removeMapping(part int, number int) {
+	for i := len(s.ccMappings) - 1; i >= 0; i-- {
+		m := s.ccMappings[i]
+		if m.part == part && m.number == number {
+			s.ccMappings = append(s.ccMappings[:i], s.ccMappings[i+1:]...)
+		}
+	}
+}
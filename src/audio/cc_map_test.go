@@ -0,0 +1,21 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestCCMapping(t *testing.T) {
+	p := newParams()
+	target, err := p.continuousParam([]string{"filter", "freq"})
+	expectNoError(t, err)
+	_, err = p.continuousParam([]string{"filter", "kind"})
+	expectEqual(t, err != nil, true)
+
+	m, err := newCCMapping(0, 74, []string{"filter", "freq"}, 100, 10100)
+	expectNoError(t, err)
+	*target = m.toValue(127)
+	expectNearlyEqual(t, p.filterParams.freq, 10100)
+	expectEqual(t, m.toCC(p.filterParams.freq), 127)
+	expectEqual(t, m.toCC(5100), 64)
+	expectEqual(t, m.toCC(-1000), 0)
+}
@@ -0,0 +1,119 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ----- Clock ----- //
+
+const (
+	clockPPQN    = 24
+	clockTimeout = 0.5 // sec
+	defaultBpm   = 120.0
+)
+
+type clock struct {
+	internalBpm float64
+	running     bool
+	lastTick    float64 // sec
+	interval    float64 // sec per tick, smoothed
+}
+
+func newClock() *clock {
+	return &clock{
+		internalBpm: defaultBpm,
+	}
+}
+
+func (c *clock) tick(timestamp float64) {
+	if c.lastTick > 0 {
+		d := timestamp - c.lastTick
+		if d < clockTimeout {
+			if c.interval == 0 {
+				c.interval = d
+			} else {
+				c.interval = c.interval*0.9 + d*0.1
+			}
+		} else {
+			c.interval = 0
+		}
+	}
+	c.lastTick = timestamp
+}
+func (c *clock) start() {
+	c.running = true
+}
+func (c *clock) stop() {
+	c.running = false
+}
+func (c *clock) synced(timestamp float64) bool {
+	return c.interval > 0 && timestamp-c.lastTick < clockTimeout
+}
+
+// rounded so that jitter of the incoming clock does not move delay times every cycle
+func (c *clock) bpm(timestamp float64) float64 {
+	if c.synced(timestamp) {
+		return math.Round(60/(c.interval*clockPPQN)*10) / 10
+	}
+	return c.internalBpm
+}
+
+type clockJSON struct {
+	Bpm     float64 `json:"bpm"`
+	Synced  bool    `json:"synced"`
+	Running bool    `json:"running"`
+}
+
+func (c *clock) toJSON(timestamp float64) *clockJSON {
+	return &clockJSON{
+		Bpm:     c.bpm(timestamp),
+		Synced:  c.synced(timestamp),
+		Running: c.running,
+	}
+}
+
+// ----- Note Division ----- //
+
+/*
+  "1/4"  -> 1 beat
+  "1/8d" -> 0.75 beat (dotted)
+  "1/8t" -> 1/3 beat (triplet)
+*/
+func divisionToBeats(s string) (float64, error) {
+	modifier := 1.0
+	if strings.HasSuffix(s, "d") {
+		modifier = 1.5
+		s = s[:len(s)-1]
+	} else if strings.HasSuffix(s, "t") {
+		modifier = 2.0 / 3.0
+		s = s[:len(s)-1]
+	}
+	fraction := strings.SplitN(s, "/", 2)
+	if len(fraction) != 2 {
+		return 0, fmt.Errorf("invalid note division %v", s)
+	}
+	numerator, err := strconv.ParseInt(fraction[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	denominator, err := strconv.ParseInt(fraction[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if numerator <= 0 || denominator <= 0 {
+		return 0, fmt.Errorf("invalid note division %v", s)
+	}
+	return 4 * float64(numerator) / float64(denominator) * modifier, nil
+}
+
+// falls back to a quarter note
+func divisionToMillis(division string, bpm float64) float64 {
+	beats, err := divisionToBeats(division)
+	if err != nil {
+		beats = 1
+	}
+	return beats * 60000 / bpm
+}
@@ -7,26 +7,53 @@ import (
 // ----- Decorated OSC -----
 
 type decoratedOsc struct {
-	oscs       []*osc
+	oscPool    []*osc // length: maxOscs
+	oscs       []*osc // resized on note on
+	fm         *fmOsc // used instead of oscs if enabled
 	adsr       *adsr
 	noteFilter *noteFilter
 	filter     *filter
 	formant    *formant
 	lfos       []*lfo
 	envelopes  []*envelope
+	expression *expression
 	modulation *modulation
+	// set by release velocity before enumNoteOff
+	releaseRatio float64
+	// set by unison
+	detuneRatio float64
+	pan         float64
+	// the latest note, for oscillators added while sounding
+	note     int
+	velocity int
 }
 
-func newDecoratedOsc() *decoratedOsc {
+// voice: index in the pool, giving each osc its own noise sequence
+func newDecoratedOsc(voice int) *decoratedOsc {
+	oscPool := make([]*osc, maxOscs)
+	for i := range oscPool {
+		oscPool[i] = newOsc(i == 0)
+		oscPool[i].noiseOffset = int64(voice*maxOscs + i)
+		if i > 0 {
+			oscPool[i].master = oscPool[0]
+		}
+	}
 	return &decoratedOsc{
-		oscs:       []*osc{newOsc(true), newOsc(false)},
+		oscPool:    oscPool,
+		oscs:       oscPool[:2],
+		fm:         newFMOsc(),
 		adsr:       &adsr{tvalue: &transitiveValue{}},
 		noteFilter: newNoteFilter(),
 		filter:     newFilter(),
 		formant:    newFormant(),
 		lfos:       []*lfo{newLfo(), newLfo(), newLfo()},
 		envelopes:  []*envelope{newEnvelope(), newEnvelope(), newEnvelope()},
+		expression: newExpression(),
 		modulation: newModulation(),
+
+		releaseRatio: 1,
+		detuneRatio:  1,
+		pan:          0,
 	}
 }
 
@@ -36,35 +63,58 @@ const (
 	enumNoteOff
 )
 
-func (o *decoratedOsc) initWithNote(p []*oscParams, note int) {
+func (o *decoratedOsc) initWithNote(p []*oscParams, tuning *tuning, note int, velocity int) {
+	o.note = note
+	o.velocity = velocity
+	o.oscs = o.oscPool[:len(p)]
 	for i, osc := range o.oscs {
-		osc.initWithNote(p[i], note)
+		osc.initWithNote(p[i], tuning, note, velocity)
 	}
+	o.fm.initWithNote(tuning, note)
 }
-func (o *decoratedOsc) glide(p []*oscParams, note int, glideTime int) {
-	for i, osc := range o.oscs {
-		osc.glide(p[i], note, glideTime)
+func (o *decoratedOsc) glide(p []*oscParams, tuning *tuning, note int, glideParams *glideParams) {
+	o.note = note
+	for i := 0; i < len(o.oscs) && i < len(p); i++ {
+		o.oscs[i].glide(p[i], tuning, note, glideParams)
 	}
+	o.fm.glide(tuning, note, glideParams)
 }
 func (o *decoratedOsc) applyParams(
 	oscParams []*oscParams,
+	fmParams *fmParams,
 	adsrParams *adsrParams,
 	noteFilterParams *noteFilterParams,
 	filterParams *filterParams,
 	formantParams *formantParams,
 	lfoParams []*lfoParams,
 	envelopeParams []*envelopeParams,
+	expressionParams *expressionParams,
+	tuning *tuning,
+	bpm float64,
 ) {
+	// the number of oscillators may have been changed while sounding
+	for i := len(o.oscs); i < len(oscParams); i++ {
+		o.oscPool[i].initWithNote(oscParams[i], tuning, o.note, o.velocity)
+	}
+	o.oscs = o.oscPool[:len(oscParams)]
+	// partials can be edited or modulated while sounding
+	for i, osc := range o.oscs {
+		if osc.kind == waveAdditive {
+			osc.partials.update(oscParams[i].additive)
+		}
+	}
+	o.fm.applyParams(fmParams)
 	o.adsr.setParams(adsrParams)
 	o.noteFilter.applyParams(noteFilterParams)
 	o.filter.applyParams(filterParams)
 	o.formant.applyParams(formantParams)
 	for i, lfo := range o.lfos {
-		lfo.applyParams(lfoParams[i])
+		lfo.applyParams(lfoParams[i], bpm)
 	}
 	for i, envelope := range o.envelopes {
 		envelope.applyParams(envelopeParams[i])
 	}
+	o.expression.applyParams(expressionParams)
 }
 
 func (o *decoratedOsc) step(event int) float64 {
@@ -72,11 +122,19 @@ func (o *decoratedOsc) step(event int) float64 {
 	case enumNoEvent:
 	case enumNoteOn:
 		o.adsr.noteOn()
+		o.fm.noteOn()
+		for _, osc := range o.oscs {
+			osc.sampler.released = false
+		}
 		for _, envelope := range o.envelopes {
 			envelope.noteOn()
 		}
 	case enumNoteOff:
-		o.adsr.noteOff()
+		o.adsr.noteOffWithReleaseRatio(o.releaseRatio)
+		o.fm.noteOff(o.releaseRatio)
+		for _, osc := range o.oscs {
+			osc.sampler.released = true
+		}
 		for _, envelope := range o.envelopes {
 			envelope.noteOff()
 		}
@@ -84,28 +142,33 @@ func (o *decoratedOsc) step(event int) float64 {
 	o.adsr.step()
 	m := o.modulation
 	m.init()
+	m.freqRatio *= o.detuneRatio
+	o.expression.step(m)
 	for _, envelope := range o.envelopes {
 		envelope.step(m)
 	}
 	for lfoIndex, lfo := range o.lfos {
 		lfo.step(o.oscs[0], m.lfoAmountGain[lfoIndex], m.lfoFreqRatio[lfoIndex], m)
 	}
+	noteFreq := o.oscs[0].freq.value
 	value := 0.0
-	for i, osc := range o.oscs {
-		v := osc.step(m.freqRatio, m.phaseShift) * oscGain * m.ampRatio * o.adsr.getValue()
-		v *= m.oscVolumeRatio[i]
-		if i == 0 && o.noteFilter.targetOsc == targetOsc0 ||
-			i == 1 && o.noteFilter.targetOsc == targetOsc1 {
-			v = o.noteFilter.step(v, m.noteFilterFreqRatio, m.noteFilterQExponent, m.noteFilterGainRatio, o.oscs[0].freq.value*m.freqRatio) // TODO: use original freq of note
-		}
-		if i == 0 && o.filter.targetOsc == targetOsc0 ||
-			i == 1 && o.filter.targetOsc == targetOsc1 {
-			v = o.filter.step(v, m.filterFreqRatio, m.filterQExponent, m.filterGainRatio)
+	if o.fm.enabled {
+		// treated as osc0
+		noteFreq = o.fm.freq.value
+		v := o.fm.step(m.freqRatio, m.phaseShift) * oscGain * m.ampRatio * o.adsr.getValue()
+		v *= m.oscVolumeRatio[0]
+		value = o.filterOsc(0, v, noteFreq, m)
+	} else {
+		for i, osc := range o.oscs {
+			osc.positionOffset = m.positionOffset
+			osc.pulseWidthOffset = m.pulseWidthOffset
+			v := osc.step(m.freqRatio, m.phaseShift) * oscGain * m.ampRatio * o.adsr.getValue()
+			v *= m.oscVolumeRatio[i]
+			value += o.filterOsc(i, v, noteFreq, m)
 		}
-		value += v
 	}
 	if o.noteFilter.targetOsc == targetOscAll {
-		value = o.noteFilter.step(value, m.filterFreqRatio, m.noteFilterQExponent, m.noteFilterGainRatio, o.oscs[0].freq.value*m.freqRatio) // TODO: use original freq of note
+		value = o.noteFilter.step(value, m.filterFreqRatio, m.noteFilterQExponent, m.noteFilterGainRatio, noteFreq*m.freqRatio) // TODO: use original freq of note
 	}
 	if o.filter.targetOsc == targetOscAll {
 		value = o.filter.step(value, m.filterFreqRatio, m.filterQExponent, m.filterGainRatio)
@@ -119,3 +182,14 @@ func (o *decoratedOsc) step(event int) float64 {
 	}
 	return value
 }
+
+// applies filters targeting the i-th oscillator
+func (o *decoratedOsc) filterOsc(i int, v float64, noteFreq float64, m *modulation) float64 {
+	if o.noteFilter.targetOsc == targetOscs[i] {
+		v = o.noteFilter.step(v, m.noteFilterFreqRatio, m.noteFilterQExponent, m.noteFilterGainRatio, noteFreq*m.freqRatio) // TODO: use original freq of note
+	}
+	if o.filter.targetOsc == targetOscs[i] {
+		v = o.filter.step(v, m.filterFreqRatio, m.filterQExponent, m.filterGainRatio)
+	}
+	return v
+}
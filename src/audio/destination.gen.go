@@ -6,6 +6,12 @@ const (
 	destNone = iota
 	destOsc0Volume
 	destOsc1Volume
+	destOsc2Volume
+	destOsc3Volume
+	destOsc4Volume
+	destOsc5Volume
+	destOsc6Volume
+	destOsc7Volume
 	destVibrato
 	destTremolo
 	destFM
@@ -24,6 +30,9 @@ const (
 	destLfo0Amount
 	destLfo1Amount
 	destLfo2Amount
+	destAmp
+	destPosition
+	destPulseWidth
 )
 
 func destinationFromString(s string) int {
@@ -34,6 +43,18 @@ func destinationFromString(s string) int {
 		return destOsc0Volume
 	case "osc1_volume":
 		return destOsc1Volume
+	case "osc2_volume":
+		return destOsc2Volume
+	case "osc3_volume":
+		return destOsc3Volume
+	case "osc4_volume":
+		return destOsc4Volume
+	case "osc5_volume":
+		return destOsc5Volume
+	case "osc6_volume":
+		return destOsc6Volume
+	case "osc7_volume":
+		return destOsc7Volume
 	case "vibrato":
 		return destVibrato
 	case "tremolo":
@@ -70,6 +91,12 @@ func destinationFromString(s string) int {
 		return destLfo1Amount
 	case "lfo2_amount":
 		return destLfo2Amount
+	case "amp":
+		return destAmp
+	case "position":
+		return destPosition
+	case "pulse_width":
+		return destPulseWidth
 	}
 	return destNone
 }
@@ -81,6 +108,18 @@ func destinationToString(d int) string {
 		return "osc0_volume"
 	case destOsc1Volume:
 		return "osc1_volume"
+	case destOsc2Volume:
+		return "osc2_volume"
+	case destOsc3Volume:
+		return "osc3_volume"
+	case destOsc4Volume:
+		return "osc4_volume"
+	case destOsc5Volume:
+		return "osc5_volume"
+	case destOsc6Volume:
+		return "osc6_volume"
+	case destOsc7Volume:
+		return "osc7_volume"
 	case destVibrato:
 		return "vibrato"
 	case destTremolo:
@@ -117,6 +156,12 @@ func destinationToString(d int) string {
 		return "lfo1_amount"
 	case destLfo2Amount:
 		return "lfo2_amount"
+	case destAmp:
+		return "amp"
+	case destPosition:
+		return "position"
+	case destPulseWidth:
+		return "pulse_width"
 	}
 	return "none"
 }
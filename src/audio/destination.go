@@ -9,6 +9,12 @@ generate-enum destination
 destNone none
 destOsc0Volume osc0_volume
 destOsc1Volume osc1_volume
+destOsc2Volume osc2_volume
+destOsc3Volume osc3_volume
+destOsc4Volume osc4_volume
+destOsc5Volume osc5_volume
+destOsc6Volume osc6_volume
+destOsc7Volume osc7_volume
 destVibrato vibrato
 destTremolo tremolo
 destFM fm
@@ -27,10 +33,13 @@ destLfo2Freq lfo2_freq
 destLfo0Amount lfo0_amount
 destLfo1Amount lfo1_amount
 destLfo2Amount lfo2_amount
+destAmp amp
+destPosition position
+destPulseWidth pulse_width
 
 EOF
 */
 
-var destOscVolume = [2]int{destOsc0Volume, destOsc1Volume}
+var destOscVolume = [maxOscs]int{destOsc0Volume, destOsc1Volume, destOsc2Volume, destOsc3Volume, destOsc4Volume, destOsc5Volume, destOsc6Volume, destOsc7Volume}
 var destLfoFreq = [3]int{destLfo0Freq, destLfo1Freq, destLfo2Freq}
 var destLfoAmount = [3]int{destLfo0Amount, destLfo1Amount, destLfo2Amount}
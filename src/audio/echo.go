@@ -38,23 +38,39 @@ func (d *delay) step(in float64) {
 func (d *delay) getDelayed() float64 {
 	return d.past[d.cursor]
 }
+func (d *delay) clear() {
+	for i := range d.past {
+		d.past[i] = 0
+	}
+}
 
 // ----- Echo ----- //
 
 type echoParams struct {
 	enabled      bool
+	delayType    string // "absolute" or "sync"
 	delay        float64
+	division     string // used when delayType is "sync"
 	feedbackGain float64
 	mix          float64
 }
 
 type echoJSON struct {
 	Enabled      bool    `json:"enabled"`
+	DelayType    string  `json:"delayType"`
 	Delay        float64 `json:"delay"`
+	Division     string  `json:"division"`
 	FeedbackGain float64 `json:"feedbackGain"`
 	Mix          float64 `json:"mix"`
 }
 
+func newEchoParams() *echoParams {
+	return &echoParams{
+		delayType: "absolute",
+		division:  "1/4",
+	}
+}
+
 func (l *echoParams) applyJSON(data json.RawMessage) {
 	var j echoJSON
 	err := json.Unmarshal(data, &j)
@@ -63,14 +79,18 @@ func (l *echoParams) applyJSON(data json.RawMessage) {
 		return
 	}
 	l.enabled = j.Enabled
+	l.delayType = j.DelayType
 	l.delay = j.Delay
+	l.division = j.Division
 	l.feedbackGain = j.FeedbackGain
 	l.mix = j.Mix
 }
 func (l *echoParams) toJSON() json.RawMessage {
 	return toRawMessage(&echoJSON{
 		Enabled:      l.enabled,
+		DelayType:    l.delayType,
 		Delay:        l.delay,
+		Division:     l.division,
 		FeedbackGain: l.feedbackGain,
 		Mix:          l.mix,
 	})
@@ -79,6 +99,14 @@ func (l *echoParams) set(key string, value string) error {
 	switch key {
 	case "enabled":
 		l.enabled = value == "true"
+	case "delay_type":
+		l.delayType = value
+	case "division":
+		_, err := divisionToBeats(value)
+		if err != nil {
+			return err
+		}
+		l.division = value
 	case "delay":
 		value, err := strconv.ParseFloat(value, 64)
 		if err != nil {
@@ -100,6 +128,17 @@ func (l *echoParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (l *echoParams) continuousParam(key string) *float64 {
+	switch key {
+	case "delay":
+		return &l.delay
+	case "feedbackGain":
+		return &l.feedbackGain
+	case "mix":
+		return &l.mix
+	}
+	return nil
+}
 
 type echo struct {
 	enabled      bool
@@ -108,13 +147,21 @@ type echo struct {
 	mix          float64 // [0,1]
 }
 
-func (e *echo) applyParams(p *echoParams) {
+func (e *echo) applyParams(p *echoParams, bpm float64) {
 	e.enabled = p.enabled
-	e.delay.applyParams(p.delay)
+	if p.delayType == "sync" {
+		e.delay.applyParams(divisionToMillis(p.division, bpm))
+	} else {
+		e.delay.applyParams(p.delay)
+	}
 	e.feedbackGain = p.feedbackGain
 	e.mix = p.mix
 }
 
+func (e *echo) clear() {
+	e.delay.clear()
+}
+
 func (e *echo) step(in float64) float64 {
 	if !e.enabled {
 		return in
@@ -122,6 +122,17 @@ func (l *envelopeParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (l *envelopeParams) continuousParam(key string) *float64 {
+	switch key {
+	case "delay":
+		return &l.delay
+	case "attack":
+		return &l.attack
+	case "amount":
+		return &l.amount
+	}
+	return nil
+}
 
 type envelope struct {
 	*adsr
@@ -169,11 +180,12 @@ func (e *envelope) step(m *modulation) {
 	if e.kind == envelopeKindGoing {
 		v = 1 - v
 	}
-	if e.destination == destOsc0Volume {
-		m.oscVolumeRatio[0] *= 1 - v
-	} else if e.destination == destOsc1Volume {
-		m.oscVolumeRatio[1] *= 1 - v
-	} else if e.destination == destFreq {
+	for i, d := range destOscVolume {
+		if e.destination == d {
+			m.oscVolumeRatio[i] *= 1 - v
+		}
+	}
+	if e.destination == destFreq {
 		m.freqRatio *= math.Pow(2.0, v*e.amount)
 	} else if e.destination == destNoteFilterFreq {
 		m.noteFilterFreqRatio *= math.Pow(2.0, v*e.amount)
@@ -199,5 +211,11 @@ func (e *envelope) step(m *modulation) {
 		m.lfoAmountGain[1] *= 1 - v
 	} else if e.destination == destLfo2Amount {
 		m.lfoAmountGain[2] *= 1 - v
+	} else if e.destination == destAmp {
+		m.ampRatio *= 1 - v
+	} else if e.destination == destPosition {
+		m.positionOffset += v * e.amount
+	} else if e.destination == destPulseWidth {
+		m.pulseWidthOffset += v * e.amount
 	}
 }
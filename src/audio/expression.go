@@ -0,0 +1,201 @@
+package audio
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"strconv"
+)
+
+// ----- Expression Params ----- //
+
+// routes per-note timbre (CC74) and pressure to destinations
+type expressionParams struct {
+	timbreDestination   int
+	timbreAmount        float64
+	pressureDestination int
+	pressureAmount      float64
+}
+
+type expressionJSON struct {
+	TimbreDestination   string  `json:"timbreDestination"`
+	TimbreAmount        float64 `json:"timbreAmount"`
+	PressureDestination string  `json:"pressureDestination"`
+	PressureAmount      float64 `json:"pressureAmount"`
+}
+
+func newExpressionParams() *expressionParams {
+	return &expressionParams{
+		timbreDestination:   destNone,
+		timbreAmount:        1,
+		pressureDestination: destNone,
+		pressureAmount:      1,
+	}
+}
+func (e *expressionParams) applyJSON(data json.RawMessage) {
+	var j expressionJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to expressionParams")
+		return
+	}
+	e.timbreDestination = destinationFromString(j.TimbreDestination)
+	e.timbreAmount = j.TimbreAmount
+	e.pressureDestination = destinationFromString(j.PressureDestination)
+	e.pressureAmount = j.PressureAmount
+}
+func (e *expressionParams) toJSON() json.RawMessage {
+	return toRawMessage(&expressionJSON{
+		TimbreDestination:   destinationToString(e.timbreDestination),
+		TimbreAmount:        e.timbreAmount,
+		PressureDestination: destinationToString(e.pressureDestination),
+		PressureAmount:      e.pressureAmount,
+	})
+}
+func (e *expressionParams) set(key string, value string) error {
+	switch key {
+	case "timbre_destination":
+		e.timbreDestination = destinationFromString(value)
+	case "timbre_amount":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		e.timbreAmount = value
+	case "pressure_destination":
+		e.pressureDestination = destinationFromString(value)
+	case "pressure_amount":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		e.pressureAmount = value
+	}
+	return nil
+}
+func (e *expressionParams) continuousParam(key string) *float64 {
+	switch key {
+	case "timbre_amount":
+		return &e.timbreAmount
+	case "pressure_amount":
+		return &e.pressureAmount
+	}
+	return nil
+}
+
+// ----- Expression ----- //
+
+// per-note (or per-channel) controller values
+type expressionValues struct {
+	bend     float64 // semitones
+	timbre   float64 // 0 ~ 1
+	pressure float64 // 0 ~ 1
+}
+
+type expression struct {
+	expressionValues
+	masterBend          float64 // semitones
+	timbreDestination   int
+	timbreAmount        float64
+	pressureDestination int
+	pressureAmount      float64
+	// cached to avoid math.Pow() in every step
+	dirty          bool
+	freqRatio      float64
+	timbreFactor   float64
+	pressureFactor float64
+}
+
+func newExpression() *expression {
+	return &expression{
+		dirty: true,
+	}
+}
+func (e *expression) applyParams(p *expressionParams) {
+	if e.timbreDestination != p.timbreDestination || e.timbreAmount != p.timbreAmount ||
+		e.pressureDestination != p.pressureDestination || e.pressureAmount != p.pressureAmount {
+		e.timbreDestination = p.timbreDestination
+		e.timbreAmount = p.timbreAmount
+		e.pressureDestination = p.pressureDestination
+		e.pressureAmount = p.pressureAmount
+		e.dirty = true
+	}
+}
+func (e *expression) init(values expressionValues, masterBend float64) {
+	e.expressionValues = values
+	e.masterBend = masterBend
+	e.dirty = true
+}
+func (e *expression) setBend(bend float64) {
+	e.bend = bend
+	e.dirty = true
+}
+func (e *expression) setMasterBend(bend float64) {
+	e.masterBend = bend
+	e.dirty = true
+}
+func (e *expression) setTimbre(timbre float64) {
+	e.timbre = timbre
+	e.dirty = true
+}
+func (e *expression) setPressure(pressure float64) {
+	e.pressure = pressure
+	e.dirty = true
+}
+
+func (e *expression) step(m *modulation) {
+	if e.dirty {
+		e.freqRatio = math.Pow(2.0, (e.bend+e.masterBend)/12)
+		e.timbreFactor = expressionFactor(e.timbreDestination, e.timbre, e.timbreAmount)
+		e.pressureFactor = expressionFactor(e.pressureDestination, e.pressure, e.pressureAmount)
+		e.dirty = false
+	}
+	m.freqRatio *= e.freqRatio
+	applyExpressionFactor(m, e.timbreDestination, e.timbreFactor)
+	applyExpressionFactor(m, e.pressureDestination, e.pressureFactor)
+}
+
+// frequencies: amount is in octaves at the maximum value
+// others:      the value fades in the destination by amount
+func expressionFactor(destination int, value float64, amount float64) float64 {
+	switch destination {
+	case destFreq, destNoteFilterFreq, destFilterFreq, destLfo0Freq, destLfo1Freq, destLfo2Freq:
+		return math.Pow(2.0, value*amount)
+	}
+	return 1 - (1-value)*amount
+}
+func applyExpressionFactor(m *modulation, destination int, factor float64) {
+	switch destination {
+	case destAmp:
+		m.ampRatio *= factor
+	case destFreq:
+		m.freqRatio *= factor
+	case destNoteFilterFreq:
+		m.noteFilterFreqRatio *= factor
+	case destNoteFilterQ:
+		m.noteFilterQExponent *= factor
+	case destNoteFilterGain:
+		m.noteFilterGainRatio *= factor
+	case destFilterFreq:
+		m.filterFreqRatio *= factor
+	case destFilterQ:
+		m.filterQExponent *= factor
+	case destFilterGain:
+		m.filterGainRatio *= factor
+	}
+	for i, d := range destOscVolume {
+		if destination == d {
+			m.oscVolumeRatio[i] *= factor
+		}
+	}
+	for i, d := range destLfoFreq {
+		if destination == d {
+			m.lfoFreqRatio[i] *= factor
+		}
+	}
+	for i, d := range destLfoAmount {
+		if destination == d {
+			m.lfoAmountGain[i] *= factor
+		}
+	}
+}
@@ -18,6 +18,7 @@ func NewFFT(length int, inverse bool) *FFT {
 	return &FFT{
 		bitReverseTable: makeBitReverseTable(length),
 		wTable:          makeWTable(length),
+		inverse:         inverse,
 	}
 }
 func makeBitReverseTable(n int) []int {
@@ -59,11 +60,10 @@ func (fft *FFT) Calc(x []complex128) {
 	for m := 1; m < n; m = m << 1 {
 		step := m << 1
 		for k := 0; k < m; k++ {
-			idx := n / step * k
+			w := fft.wTable[n/step*k]
 			if fft.inverse {
-				idx = n - idx
+				w = cmplx.Conj(w)
 			}
-			w := fft.wTable[idx]
 			for i := k; i < n; i += step {
 				j := i + m
 				tmp := x[j] * w
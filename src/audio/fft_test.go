@@ -41,3 +41,19 @@ func TestFFT(t *testing.T) {
 	expectNearlyEqual(t, x[6], 0)
 	expectNearlyEqual(t, x[7], -(1 + math.Sqrt(2)/2))
 }
+
+func TestInverseFFT(t *testing.T) {
+	forward := NewFFT(8, false)
+	inverse := NewFFT(8, true)
+	original := []float64{0, 0.25, 0.5, 0.75, 1, -0.75, 0.5, 0.25}
+	x := make([]complex128, len(original))
+	for i, value := range original {
+		x[i] = complex(value, 0)
+	}
+	forward.Calc(x)
+	inverse.Calc(x)
+	for i, value := range original {
+		expectNearlyEqual(t, real(x[i]), value)
+		expectNearlyEqual(t, imag(x[i]), 0)
+	}
+}
@@ -102,6 +102,17 @@ func (f *filterParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (f *filterParams) continuousParam(key string) *float64 {
+	switch key {
+	case "freq":
+		return &f.freq
+	case "q":
+		return &f.q
+	case "gain":
+		return &f.gain
+	}
+	return nil
+}
 
 // ----- Note Filter Params ----- //
 
@@ -186,6 +197,15 @@ func (f *noteFilterParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (f *noteFilterParams) continuousParam(key string) *float64 {
+	switch key {
+	case "q":
+		return &f.q
+	case "gain":
+		return &f.gain
+	}
+	return nil
+}
 
 // ----- Filter ----- //
 
@@ -295,10 +315,18 @@ generate-enum targetOsc
 targetOscAll all
 targetOsc0 0
 targetOsc1 1
+targetOsc2 2
+targetOsc3 3
+targetOsc4 4
+targetOsc5 5
+targetOsc6 6
+targetOsc7 7
 
 EOF
 */
 
+var targetOscs = [maxOscs]int{targetOsc0, targetOsc1, targetOsc2, targetOsc3, targetOsc4, targetOsc5, targetOsc6, targetOsc7}
+
 type noteFilter struct {
 	*filter
 	targetOsc int
@@ -0,0 +1,363 @@
+package audio
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"strconv"
+)
+
+const maxOperators = 6
+
+// modulation index of a modulator at level 1 (about the same as DX7)
+const fmMaxIndex = 4 * math.Pi
+
+// ----- FM Algorithm ----- //
+
+// operators are numbered from 0, and modulated only by higher ones
+//go:generate go run ../gen/main.go -- fm_algorithm.gen.go
+/*
+generate-enum fmAlgorithm
+
+fmThreePairs three_pairs
+fmTwoStacks two_stacks
+fmStack6 stack6
+fmTwoPairs two_pairs
+fmStack4 stack4
+fmBranch4 branch4
+fmAdditive additive
+
+EOF
+*/
+
+type fmAlgorithm struct {
+	operators  int     // 4 or 6
+	modulators [][]int // by operator
+	carriers   []int
+	feedback   int // operator modulating itself
+}
+
+// in the same order as the enum
+var fmAlgorithms = []*fmAlgorithm{
+	{ // 1->0, 3->2, 5->4
+		operators:  6,
+		modulators: [][]int{{1}, {}, {3}, {}, {5}, {}},
+		carriers:   []int{0, 2, 4},
+		feedback:   5,
+	},
+	{ // 2->1->0, 5->4->3
+		operators:  6,
+		modulators: [][]int{{1}, {2}, {}, {4}, {5}, {}},
+		carriers:   []int{0, 3},
+		feedback:   5,
+	},
+	{ // 5->4->3->2->1->0
+		operators:  6,
+		modulators: [][]int{{1}, {2}, {3}, {4}, {5}, {}},
+		carriers:   []int{0},
+		feedback:   5,
+	},
+	{ // 1->0, 3->2
+		operators:  4,
+		modulators: [][]int{{1}, {}, {3}, {}},
+		carriers:   []int{0, 2},
+		feedback:   3,
+	},
+	{ // 3->2->1->0
+		operators:  4,
+		modulators: [][]int{{1}, {2}, {3}, {}},
+		carriers:   []int{0},
+		feedback:   3,
+	},
+	{ // (1, 2, 3)->0
+		operators:  4,
+		modulators: [][]int{{1, 2, 3}, {}, {}, {}},
+		carriers:   []int{0},
+		feedback:   3,
+	},
+	{ // all carriers
+		operators:  6,
+		modulators: [][]int{{}, {}, {}, {}, {}, {}},
+		carriers:   []int{0, 1, 2, 3, 4, 5},
+		feedback:   5,
+	},
+}
+
+// ----- FM Params ----- //
+
+type fmOperatorParams struct {
+	fixed      bool
+	ratio      float64 // to the note frequency
+	freq       float64 // Hz, used if fixed
+	detune     float64 // cent
+	level      float64 // 0 ~ 1
+	adsrParams *adsrParams
+}
+type fmOperatorJSON struct {
+	Fixed    bool            `json:"fixed"`
+	Ratio    float64         `json:"ratio"`
+	Freq     float64         `json:"freq"`
+	Detune   float64         `json:"detune"`
+	Level    float64         `json:"level"`
+	Envelope json.RawMessage `json:"envelope"`
+}
+
+func newFMOperatorParams(level float64) *fmOperatorParams {
+	return &fmOperatorParams{
+		ratio:      1,
+		freq:       440,
+		level:      level,
+		adsrParams: &adsrParams{attack: 0, decay: 0, sustain: 1, release: 1000},
+	}
+}
+func (o *fmOperatorParams) applyJSON(data json.RawMessage) {
+	var j fmOperatorJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to fmOperatorParams")
+		return
+	}
+	o.fixed = j.Fixed
+	o.ratio = j.Ratio
+	o.freq = j.Freq
+	o.detune = j.Detune
+	o.level = j.Level
+	o.adsrParams.applyJSON(j.Envelope)
+}
+func (o *fmOperatorParams) toJSON() json.RawMessage {
+	return toRawMessage(&fmOperatorJSON{
+		Fixed:    o.fixed,
+		Ratio:    o.ratio,
+		Freq:     o.freq,
+		Detune:   o.detune,
+		Level:    o.level,
+		Envelope: o.adsrParams.toJSON(),
+	})
+}
+func (o *fmOperatorParams) set(key string, value string) error {
+	switch key {
+	case "fixed":
+		o.fixed = value == "true"
+	case "ratio":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.ratio = value
+	case "freq":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.freq = value
+	case "detune":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.detune = value
+	case "level":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.level = value
+	default:
+		return o.adsrParams.set(key, value)
+	}
+	return nil
+}
+func (o *fmOperatorParams) continuousParam(key string) *float64 {
+	switch key {
+	case "ratio":
+		return &o.ratio
+	case "freq":
+		return &o.freq
+	case "detune":
+		return &o.detune
+	case "level":
+		return &o.level
+	}
+	return o.adsrParams.continuousParam(key)
+}
+
+type fmParams struct {
+	enabled   bool // replaces the oscillators
+	algorithm int
+	feedback  float64 // 0 ~ 1
+	operators []*fmOperatorParams
+}
+type fmJSON struct {
+	Enabled   bool              `json:"enabled"`
+	Algorithm string            `json:"algorithm"`
+	Feedback  float64           `json:"feedback"`
+	Operators []json.RawMessage `json:"operators"`
+}
+
+func newFMParams() *fmParams {
+	operators := make([]*fmOperatorParams, maxOperators)
+	for i := range operators {
+		level := 0.0
+		if i == 0 {
+			level = 1.0
+		}
+		operators[i] = newFMOperatorParams(level)
+	}
+	return &fmParams{
+		enabled:   false,
+		algorithm: fmThreePairs,
+		feedback:  0,
+		operators: operators,
+	}
+}
+func (f *fmParams) applyJSON(data json.RawMessage) {
+	var j fmJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to fmParams")
+		return
+	}
+	f.enabled = j.Enabled
+	f.algorithm = fmAlgorithmFromString(j.Algorithm)
+	f.feedback = j.Feedback
+	if len(j.Operators) == len(f.operators) {
+		for i, j := range j.Operators {
+			f.operators[i].applyJSON(j)
+		}
+	} else {
+		log.Println("failed to apply JSON to fm operator params")
+	}
+}
+func (f *fmParams) toJSON() json.RawMessage {
+	operatorJsons := make([]json.RawMessage, len(f.operators))
+	for i, operator := range f.operators {
+		operatorJsons[i] = operator.toJSON()
+	}
+	return toRawMessage(&fmJSON{
+		Enabled:   f.enabled,
+		Algorithm: fmAlgorithmToString(f.algorithm),
+		Feedback:  f.feedback,
+		Operators: operatorJsons,
+	})
+}
+func (f *fmParams) set(key string, value string) error {
+	switch key {
+	case "enabled":
+		f.enabled = value == "true"
+	case "algorithm":
+		f.algorithm = fmAlgorithmFromString(value)
+	case "feedback":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.feedback = value
+	}
+	return nil
+}
+func (f *fmParams) continuousParam(key string) *float64 {
+	switch key {
+	case "feedback":
+		return &f.feedback
+	}
+	return nil
+}
+
+// ----- FM OSC ----- //
+
+type fmOperator struct {
+	adsr        *adsr
+	fixed       bool
+	ratio       float64
+	freq        float64
+	detuneRatio float64
+	level       float64
+	phase       float64
+	out         float64 // the latest value
+	prevOut     float64 // for feedback
+}
+
+// sine operators as an alternative to the oscillators of decoratedOsc
+type fmOsc struct {
+	enabled   bool
+	algorithm *fmAlgorithm
+	feedback  float64
+	freq      *transitiveValue // of the note
+	operators []*fmOperator
+}
+
+func newFMOsc() *fmOsc {
+	operators := make([]*fmOperator, maxOperators)
+	for i := range operators {
+		operators[i] = &fmOperator{
+			adsr:        &adsr{tvalue: &transitiveValue{}},
+			detuneRatio: 1,
+		}
+	}
+	return &fmOsc{
+		algorithm: fmAlgorithms[fmThreePairs],
+		freq:      newTransitiveValue(),
+		operators: operators,
+	}
+}
+func (f *fmOsc) applyParams(p *fmParams) {
+	f.enabled = p.enabled
+	f.algorithm = fmAlgorithms[p.algorithm]
+	f.feedback = p.feedback
+	for i, op := range f.operators {
+		params := p.operators[i]
+		op.adsr.setParams(params.adsrParams)
+		op.fixed = params.fixed
+		op.ratio = params.ratio
+		op.freq = params.freq
+		op.detuneRatio = math.Pow(2, params.detune/100/12)
+		op.level = params.level
+	}
+}
+func (f *fmOsc) initWithNote(tuning *tuning, note int) {
+	f.freq.init(tuning.freq(note))
+}
+func (f *fmOsc) glide(tuning *tuning, note int, glideParams *glideParams) {
+	nextFreq := tuning.freq(note)
+	f.freq.linear(glideParams.duration(f.freq.value, nextFreq), nextFreq)
+}
+func (f *fmOsc) noteOn() {
+	for _, op := range f.operators {
+		op.adsr.noteOn()
+		op.phase = 0
+		op.out = 0
+		op.prevOut = 0
+	}
+}
+func (f *fmOsc) noteOff(releaseRatio float64) {
+	for _, op := range f.operators {
+		op.adsr.noteOffWithReleaseRatio(releaseRatio)
+	}
+}
+func (f *fmOsc) step(freqRatio float64, phaseShift float64) float64 {
+	f.freq.step()
+	a := f.algorithm
+	for i := a.operators - 1; i >= 0; i-- {
+		op := f.operators[i]
+		op.adsr.step()
+		mod := phaseShift
+		for _, j := range a.modulators[i] {
+			mod += f.operators[j].out * fmMaxIndex
+		}
+		if i == a.feedback {
+			mod += (op.out + op.prevOut) / 2 * f.feedback * math.Pi
+		}
+		op.prevOut = op.out
+		op.out = math.Sin(op.phase+mod) * op.level * op.adsr.getValue()
+		freq := f.freq.value * freqRatio * op.ratio
+		if op.fixed {
+			freq = op.freq
+		}
+		op.phase = math.Mod(op.phase+2.0*math.Pi*freq*op.detuneRatio/float64(sampleRate), 2.0*math.Pi)
+	}
+	value := 0.0
+	for _, i := range a.carriers {
+		value += f.operators[i].out
+	}
+	return value / float64(len(a.carriers))
+}
@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFMAlgorithms(t *testing.T) {
+	expectEqual(t, len(fmAlgorithms), fmAdditive+1)
+	for _, a := range fmAlgorithms {
+		expectEqual(t, len(a.modulators), a.operators)
+		for i, modulators := range a.modulators {
+			for _, j := range modulators {
+				expectEqual(t, j > i && j < a.operators, true)
+			}
+		}
+		expectEqual(t, a.feedback < a.operators, true)
+	}
+}
+
+func TestFMOsc(t *testing.T) {
+	p := newFMParams()
+	f := newFMOsc()
+	f.applyParams(p)
+	f.initWithNote(newTuning(), 69)
+	f.noteOn()
+	// only operator 0 sounds by default
+	for i := 0; i < 100; i++ {
+		phase := 2 * math.Pi * 442 * float64(i) / sampleRate
+		expectNearlyEqual(t, f.step(1, 0), math.Sin(phase)/3)
+	}
+
+	// modulated by operator 1 with a fixed frequency
+	expectNoError(t, p.operators[1].set("level", "0.5"))
+	expectNoError(t, p.operators[1].set("fixed", "true"))
+	expectNoError(t, p.operators[1].set("freq", "100"))
+	f.applyParams(p)
+	f.noteOn()
+	differs := false
+	for i := 0; i < 100; i++ {
+		phase := 2 * math.Pi * 442 * float64(i) / sampleRate
+		mod := math.Sin(2*math.Pi*100*float64(i)/sampleRate) * 0.5 * fmMaxIndex
+		expectNearlyEqual(t, f.step(1, 0), math.Sin(phase+mod)/3)
+		differs = differs || math.Abs(mod) > 0.1
+	}
+	expectEqual(t, differs, true)
+
+	// operator envelopes
+	expectNoError(t, p.operators[0].set("sustain", "0"))
+	expectNoError(t, p.operators[0].set("decay", "1"))
+	f.applyParams(p)
+	f.noteOn()
+	for i := 0; i < sampleRate/100; i++ {
+		f.step(1, 0)
+	}
+	expectNearlyEqual(t, f.step(1, 0), 0)
+}
+
+func TestFMParams(t *testing.T) {
+	p := newParams()
+	expectNoError(t, p.fmParams.set("enabled", "true"))
+	expectNoError(t, p.fmParams.set("algorithm", "stack4"))
+	expectNoError(t, p.fmParams.operators[3].set("ratio", "3.5"))
+	expectNoError(t, p.fmParams.operators[3].set("release", "50"))
+	value, err := p.continuousParam([]string{"fm_op", "3", "level"})
+	expectNoError(t, err)
+	*value = 0.25
+	p2 := newParams()
+	p2.applyJSON(p.toJSON())
+	expectEqual(t, p2.fmParams.enabled, true)
+	expectEqual(t, p2.fmParams.algorithm, fmStack4)
+	expectEqual(t, p2.fmParams.operators[3].ratio, 3.5)
+	expectEqual(t, p2.fmParams.operators[3].level, 0.25)
+	expectEqual(t, p2.fmParams.operators[3].adsrParams.release, 50.0)
+
+	o := newDecoratedOsc(0)
+	o.applyParams(p2.oscParams, p2.fmParams, p2.adsrParams, p2.noteFilterParams, p2.filterParams, p2.formantParams, p2.lfoParams, p2.envelopeParams, p2.expressionParams, newTuning(), defaultBpm)
+	o.initWithNote(p2.oscParams, newTuning(), 60, 127)
+	o.step(enumNoteOn)
+	sounding := false
+	for i := 0; i < 1000; i++ {
+		sounding = sounding || o.step(enumNoEvent) != 0
+	}
+	expectEqual(t, sounding, true)
+}
@@ -78,6 +78,15 @@ func (f *formantParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (f *formantParams) continuousParam(key string) *float64 {
+	switch key {
+	case "tone":
+		return &f.tone
+	case "q":
+		return &f.q
+	}
+	return nil
+}
 
 // ----- Formant ----- //
 
@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"strconv"
+)
+
+// ----- Glide Kind ----- //
+
+//go:generate go run ../gen/main.go -- glide_kind.gen.go
+/*
+generate-enum glideKind
+
+glideConstantTime time
+glideConstantRate rate
+
+EOF
+*/
+
+// ----- Poly Glide Source ----- //
+
+//go:generate go run ../gen/main.go -- poly_glide.gen.go
+/*
+generate-enum polyGlide
+
+polyGlideOff off
+polyGlideLast last
+polyGlideNearest nearest
+
+EOF
+*/
+
+// ----- Glide Params ----- //
+
+type glideParams struct {
+	time       int // ms, or ms per semitone if kind is glideConstantRate
+	kind       int
+	legatoOnly bool // glides only while another note is held
+	poly       int  // where a new voice glides from in poly mode
+}
+
+// time is saved as "glideTime" for compatibility
+type glideJSON struct {
+	Kind       string `json:"kind"`
+	LegatoOnly bool   `json:"legatoOnly"`
+	Poly       string `json:"poly"`
+}
+
+func newGlideParams() *glideParams {
+	return &glideParams{
+		time:       100,
+		kind:       glideConstantTime,
+		legatoOnly: true,
+		poly:       polyGlideOff,
+	}
+}
+func (g *glideParams) applyJSON(data json.RawMessage) {
+	var j glideJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to glideParams")
+		return
+	}
+	g.kind = glideKindFromString(j.Kind)
+	g.legatoOnly = j.LegatoOnly
+	g.poly = polyGlideFromString(j.Poly)
+}
+func (g *glideParams) toJSON() json.RawMessage {
+	return toRawMessage(&glideJSON{
+		Kind:       glideKindToString(g.kind),
+		LegatoOnly: g.legatoOnly,
+		Poly:       polyGlideToString(g.poly),
+	})
+}
+func (g *glideParams) set(key string, value string) error {
+	switch key {
+	case "time":
+		value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		g.time = int(value)
+	case "kind":
+		g.kind = glideKindFromString(value)
+	case "legato_only":
+		g.legatoOnly = value == "true"
+	case "poly":
+		g.poly = polyGlideFromString(value)
+	}
+	return nil
+}
+
+// returns ms to glide between the frequencies
+func (g *glideParams) duration(fromFreq float64, toFreq float64) float64 {
+	if g.kind == glideConstantRate {
+		if fromFreq <= 0 || toFreq <= 0 {
+			return 0
+		}
+		semitones := math.Abs(12 * math.Log2(toFreq/fromFreq))
+		return float64(g.time) * semitones
+	}
+	return float64(g.time)
+}
@@ -0,0 +1,32 @@
+// Code generated by gen/main.go; DO NOT EDIT.
+
+package audio
+
+const (
+	interpolationLinear = iota
+	interpolationCubic
+	interpolationNone
+)
+
+func interpolationFromString(s string) int {
+	switch s {
+	case "linear":
+		return interpolationLinear
+	case "cubic":
+		return interpolationCubic
+	case "none":
+		return interpolationNone
+	}
+	return interpolationLinear
+}
+func interpolationToString(d int) string {
+	switch d {
+	case interpolationLinear:
+		return "linear"
+	case interpolationCubic:
+		return "cubic"
+	case interpolationNone:
+		return "none"
+	}
+	return "linear"
+}
@@ -13,8 +13,9 @@ type lfoParams struct {
 	enabled     bool
 	destination int
 	wave        int
-	freqType    string
+	freqType    string // "absolute" or "sync"
 	freq        float64
+	division    string // used when freqType is "sync"
 	amount      float64
 }
 
@@ -24,6 +25,7 @@ type lfoJSON struct {
 	Wave        string  `json:"wave"`
 	FreqType    string  `json:"freqType"`
 	Freq        float64 `json:"freq"`
+	Division    string  `json:"division"`
 	Amount      float64 `json:"amount"`
 }
 
@@ -39,6 +41,7 @@ func (l *lfoParams) applyJSON(data json.RawMessage) {
 	l.wave = waveKindFromString(j.Wave)
 	l.freqType = j.FreqType
 	l.freq = j.Freq
+	l.division = j.Division
 	l.amount = j.Amount
 }
 func (l *lfoParams) toJSON() json.RawMessage {
@@ -48,6 +51,7 @@ func (l *lfoParams) toJSON() json.RawMessage {
 		Wave:        waveKindToString(l.wave),
 		FreqType:    l.freqType,
 		Freq:        l.freq,
+		Division:    l.division,
 		Amount:      l.amount,
 	})
 }
@@ -59,6 +63,7 @@ func newLfoParams() *lfoParams {
 		wave:        waveSine,
 		freqType:    "none",
 		freq:        0,
+		division:    "1/4",
 		amount:      0,
 	}
 }
@@ -87,6 +92,14 @@ func (l *lfoParams) set(key string, value string) error {
 		l.destination = destinationFromString(value)
 	case "wave":
 		l.wave = waveKindFromString(value)
+	case "freq_type":
+		l.freqType = value
+	case "division":
+		_, err := divisionToBeats(value)
+		if err != nil {
+			return err
+		}
+		l.division = value
 	case "freq":
 		value, err := strconv.ParseFloat(value, 64)
 		if err != nil {
@@ -102,6 +115,15 @@ func (l *lfoParams) set(key string, value string) error {
 	}
 	return nil
 }
+func (l *lfoParams) continuousParam(key string) *float64 {
+	switch key {
+	case "freq":
+		return &l.freq
+	case "amount":
+		return &l.amount
+	}
+	return nil
+}
 
 // ----- LFO ----- //
 
@@ -123,12 +145,16 @@ func newLfo() *lfo {
 	}
 }
 
-func (l *lfo) applyParams(p *lfoParams) {
+func (l *lfo) applyParams(p *lfoParams, bpm float64) {
 	l.enabled = p.enabled
 	l.destination = p.destination
 	l.osc.kind = p.wave // TODO
 	l.freqType = p.freqType
-	l.osc.freq.value = p.freq // TODO
+	if p.freqType == "sync" {
+		l.osc.freq.value = 1000 / divisionToMillis(p.division, bpm)
+	} else {
+		l.osc.freq.value = p.freq // TODO
+	}
 	l.amount = p.amount
 }
 
@@ -158,5 +184,11 @@ func (l *lfo) step(career *osc, amountGain float64, lfoFreqRatio float64, m *mod
 	case destFilterFreq:
 		amount := l.amount * amountGain
 		m.filterFreqRatio *= math.Pow(16.0, l.osc.step(lfoFreqRatio, 0.0)*amount)
+	case destPosition:
+		amount := l.amount * amountGain
+		m.positionOffset += l.osc.step(lfoFreqRatio, 0.0) * amount
+	case destPulseWidth:
+		amount := l.amount * amountGain
+		m.pulseWidthOffset += l.osc.step(lfoFreqRatio, 0.0) * amount
 	}
 }
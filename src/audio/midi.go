@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 
+	"gitlab.com/gomidi/midi"
 	"gitlab.com/gomidi/rtmididrv"
 )
 
@@ -63,3 +64,64 @@ func ListenToMidiIn(ctx context.Context) <-chan []byte {
 	}()
 	return ch
 }
+
+// SendToMidiOut ...
+func SendToMidiOut(ctx context.Context, ch <-chan []byte) {
+	go func() {
+		out, closeOut := openMidiOut()
+		if closeOut != nil {
+			defer closeOut()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case data := <-ch:
+				if out == nil {
+					continue
+				}
+				if _, err := out.Write(data); err != nil {
+					log.Printf("failed to write to MIDI OUT: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+func openMidiOut() (midi.Out, func()) {
+	drv, err := rtmididrv.New()
+	if err != nil {
+		log.Printf("failed to initialize MIDI driver: %v\n", err)
+		return nil, nil
+	}
+	closeDriver := func() {
+		err := drv.Close()
+		if err != nil {
+			log.Printf("failed to close MIDI driver: %v\n", err)
+		}
+	}
+	outs, err := drv.Outs()
+	if err != nil {
+		log.Printf("failed to get MIDI OUT: %v\n", err)
+		return nil, closeDriver
+	}
+	log.Printf("MIDI OUT: %v\n", outs)
+
+	if len(outs) == 0 {
+		log.Println("WARN: MIDI OUT not fonud")
+		return nil, closeDriver
+	}
+	out := outs[0]
+	if err := out.Open(); err != nil {
+		log.Printf("failed to open MIDI OUT: %v\n", err)
+		return nil, closeDriver
+	}
+	log.Println("opened " + out.String())
+	return out, func() {
+		err := out.Close()
+		if err != nil {
+			log.Printf("failed to close MIDI OUT: %v\n", err)
+		}
+		closeDriver()
+	}
+}
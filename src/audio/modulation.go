@@ -15,11 +15,13 @@ type modulation struct {
 	filterGainRatio     float64
 	lfoAmountGain       []float64
 	lfoFreqRatio        []float64
+	positionOffset      float64
+	pulseWidthOffset    float64
 }
 
 func newModulation() *modulation {
 	m := &modulation{
-		oscVolumeRatio: make([]float64, 2),
+		oscVolumeRatio: make([]float64, maxOscs),
 		lfoAmountGain:  make([]float64, 3),
 		lfoFreqRatio:   make([]float64, 3),
 	}
@@ -27,8 +29,9 @@ func newModulation() *modulation {
 	return m
 }
 func (m *modulation) init() {
-	m.oscVolumeRatio[0] = 1.0
-	m.oscVolumeRatio[1] = 1.0
+	for i := range m.oscVolumeRatio {
+		m.oscVolumeRatio[i] = 1.0
+	}
 	m.freqRatio = 1.0
 	m.phaseShift = 0.0
 	m.ampRatio = 1.0
@@ -44,4 +47,6 @@ func (m *modulation) init() {
 	m.lfoFreqRatio[0] = 1.0
 	m.lfoFreqRatio[1] = 1.0
 	m.lfoFreqRatio[2] = 1.0
+	m.positionOffset = 0.0
+	m.pulseWidthOffset = 0.0
 }
@@ -1,41 +1,129 @@
 package audio
 
+import (
+	"encoding/json"
+	"log"
+)
+
+// ----- Note Priority ----- //
+
+//go:generate go run ../gen/main.go -- note_priority.gen.go
+/*
+generate-enum notePriority
+
+priorityLast last
+priorityLow low
+priorityHigh high
+
+EOF
+*/
+
+// ----- Mono Params ----- //
+
+type monoParams struct {
+	priority  int
+	retrigger bool // restarts envelopes on every note change, otherwise only on the first note (legato)
+}
+
+type monoJSON struct {
+	Priority  string `json:"priority"`
+	Retrigger bool   `json:"retrigger"`
+}
+
+func newMonoParams() *monoParams {
+	return &monoParams{
+		priority:  priorityLast,
+		retrigger: false,
+	}
+}
+func (m *monoParams) applyJSON(data json.RawMessage) {
+	var j monoJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to monoParams")
+		return
+	}
+	m.priority = notePriorityFromString(j.Priority)
+	m.retrigger = j.Retrigger
+}
+func (m *monoParams) toJSON() json.RawMessage {
+	return toRawMessage(&monoJSON{
+		Priority:  notePriorityToString(m.priority),
+		Retrigger: m.retrigger,
+	})
+}
+func (m *monoParams) set(key string, value string) error {
+	switch key {
+	case "priority":
+		m.priority = notePriorityFromString(value)
+	case "retrigger":
+		m.retrigger = value == "true"
+	}
+	return nil
+}
+
 // ----- MONO OSC ----- //
 
 type monoOsc struct {
-	o           *decoratedOsc
-	activeNotes []*noteOn
+	pool        []*decoratedOsc // length: maxUnison
+	voices      []*decoratedOsc // unison voices of the current note
+	activeNotes []*noteOn       // the latest first
+	current     *noteOn         // nil if no notes are held
+	played      bool            // whether the oscillators have a pitch to glide from
 	gain        *transitiveValue
+	pedal       *pedal
 }
 
 func newMonoOsc() *monoOsc {
+	pool := make([]*decoratedOsc, maxUnison)
+	for i := range pool {
+		pool[i] = newDecoratedOsc(i)
+	}
 	return &monoOsc{
-		o:           newDecoratedOsc(),
+		pool:        pool,
+		voices:      pool[:1],
 		activeNotes: make([]*noteOn, 0, 128),
 		gain:        newTransitiveValue(),
+		pedal:       newPedal(),
 	}
 }
 
 func (m *monoOsc) calc(
 	events [][]*midiEvent,
 	oscParams []*oscParams,
+	fmParams *fmParams,
 	adsrParams *adsrParams,
 	noteFilterParams *noteFilterParams,
 	filterParams *filterParams,
 	formantParams *formantParams,
 	lfoParams []*lfoParams,
 	envelopeParams []*envelopeParams,
+	expressionParams *expressionParams,
 	velSense float64,
-	glideTime int,
-	echo *echo,
-	out []float64,
+	velocityParams *velocityParams,
+	tuning *tuning,
+	monoParams *monoParams,
+	glideParams *glideParams,
+	unisonParams *unisonParams,
+	bpm float64,
+	echoes []*echo,
+	outL []float64,
+	outR []float64,
 ) {
-	m.o.applyParams(oscParams, adsrParams, noteFilterParams, filterParams, formantParams, lfoParams, envelopeParams)
-	for i := int64(0); i < int64(len(out)); i++ {
+	for u, o := range m.voices {
+		o.applyParams(oscParams, fmParams, adsrParams, noteFilterParams, filterParams, formantParams, lfoParams, envelopeParams, expressionParams, tuning, bpm)
+		o.detuneRatio, o.pan = unisonParams.voice(u, len(m.voices))
+	}
+	for i := int64(0); i < int64(len(outL)); i++ {
 		event := enumNoEvent
 		for _, e := range events[i] {
 			switch data := e.event.(type) {
 			case *noteOn:
+				if !tuning.mapped(data.note) {
+					break
+				}
+				m.pedal.noteOn(data.note)
+				m.removeNote(data.note)
 				if len(m.activeNotes) < cap(m.activeNotes) {
 					m.activeNotes = m.activeNotes[:len(m.activeNotes)+1]
 					for i := len(m.activeNotes) - 1; i >= 1; i-- {
@@ -43,37 +131,173 @@ func (m *monoOsc) calc(
 					}
 					m.activeNotes[0] = data
 					if len(m.activeNotes) == 1 {
-						m.o.initWithNote(oscParams, data.note)
-						gain := velocityToGain(data.velocity, velSense)
-						m.gain.init(gain)
-						event = enumNoteOn
-					} else {
-						m.o.glide(oscParams, m.activeNotes[0].note, glideTime)
-						gain := velocityToGain(data.velocity, velSense)
-						m.gain.exponential(float64(glideTime), gain, 0.001)
+						m.current = nil // not legato even if the same note is pressed again
+					}
+					if e := m.changeNote(oscParams, velSense, velocityParams, tuning, monoParams, glideParams, unisonParams); e != enumNoEvent {
+						event = e
 					}
 				}
 			case *noteOff:
-				removed := 0
-				for i := 0; i < len(m.activeNotes); i++ {
-					if m.activeNotes[i].note == data.note {
-						removed++
+				if !m.pedal.noteOff(data.note) {
+					m.removeNote(data.note)
+					if e := m.changeNote(oscParams, velSense, velocityParams, tuning, monoParams, glideParams, unisonParams); e != enumNoEvent {
+						if e == enumNoteOff {
+							m.setReleaseRatio(velocityParams.releaseRatio(data.velocity))
+						}
+						event = e
+					}
+				}
+			case *controlChange:
+				switch data.number {
+				case ccAllNotesOff:
+					m.pedal.reset()
+					if len(m.activeNotes) > 0 {
+						m.activeNotes = m.activeNotes[:0]
+						m.current = nil
+						m.setReleaseRatio(1)
+						event = enumNoteOff
+					}
+				case ccAllSoundOff:
+					m.pedal.reset()
+					m.activeNotes = m.activeNotes[:0]
+					m.current = nil
+					for _, o := range m.voices {
+						o.adsr.reset()
+					}
+					for _, echo := range echoes {
+						echo.clear()
+					}
+					event = enumNoEvent
+				case ccTimbre:
+					for _, o := range m.voices {
+						o.expression.setTimbre(float64(data.value) / 127)
+					}
+				}
+				for _, note := range m.pedal.controlChange(data.number, data.value) {
+					m.removeNote(note)
+					if e := m.changeNote(oscParams, velSense, velocityParams, tuning, monoParams, glideParams, unisonParams); e != enumNoEvent {
+						if e == enumNoteOff {
+							m.setReleaseRatio(1)
+						}
+						event = e
+					}
+				}
+			case *pitchBend:
+				for _, o := range m.voices {
+					if data.master {
+						o.expression.setMasterBend(data.semitones)
 					} else {
-						m.activeNotes[i-removed] = m.activeNotes[i]
+						o.expression.setBend(data.semitones)
 					}
 				}
-				m.activeNotes = m.activeNotes[:len(m.activeNotes)-removed]
-				if len(m.activeNotes) > 0 {
-					m.o.glide(oscParams, m.activeNotes[0].note, glideTime)
-					gain := velocityToGain(m.activeNotes[0].velocity, velSense)
-					m.gain.exponential(float64(glideTime), gain, 0.001)
-				} else {
-					event = enumNoteOff
+			case *channelPressure:
+				for _, o := range m.voices {
+					o.expression.setPressure(data.value)
+				}
+			case *polyPressure:
+				if m.current != nil && m.current.note == data.note {
+					for _, o := range m.voices {
+						o.expression.setPressure(data.value)
+					}
 				}
 			}
 		}
 		m.gain.step()
-		value := m.o.step(event) * m.gain.value
-		out[i] = echo.step(value)
+		gain := m.gain.value * unisonGain(len(m.voices))
+		left := 0.0
+		right := 0.0
+		for _, o := range m.voices {
+			value := o.step(event) * gain
+			gainL, gainR := panGains(o.pan)
+			left += value * gainL
+			right += value * gainR
+		}
+		outL[i] = echoes[0].step(left)
+		outR[i] = echoes[1].step(right)
+	}
+}
+
+func (m *monoOsc) setReleaseRatio(releaseRatio float64) {
+	for _, o := range m.voices {
+		o.releaseRatio = releaseRatio
+	}
+}
+
+func (m *monoOsc) removeNote(note int) {
+	removed := 0
+	for i := 0; i < len(m.activeNotes); i++ {
+		if m.activeNotes[i].note == note {
+			removed++
+		} else {
+			m.activeNotes[i-removed] = m.activeNotes[i]
+		}
+	}
+	m.activeNotes = m.activeNotes[:len(m.activeNotes)-removed]
+}
+
+// sounds the note selected by the priority after the held notes changed, and returns the event for envelopes
+func (m *monoOsc) changeNote(
+	oscParams []*oscParams,
+	velSense float64,
+	velocityParams *velocityParams,
+	tuning *tuning,
+	monoParams *monoParams,
+	glideParams *glideParams,
+	unisonParams *unisonParams,
+) int {
+	if len(m.activeNotes) == 0 {
+		if m.current == nil {
+			return enumNoEvent
+		}
+		m.current = nil
+		return enumNoteOff
+	}
+	next := m.selectNote(monoParams.priority)
+	if next == m.current {
+		return enumNoEvent
+	}
+	prev := m.current
+	m.current = next
+	gain := velocityToGain(next.velocity, velSense, velocityParams)
+	if prev != nil {
+		for _, o := range m.voices {
+			o.glide(oscParams, tuning, next.note, glideParams)
+		}
+		duration := glideParams.duration(tuning.freq(prev.note), tuning.freq(next.note))
+		m.gain.exponential(duration, gain, 0.001)
+	} else if m.played && !glideParams.legatoOnly && len(m.voices) == unisonParams.voices {
+		for _, o := range m.voices {
+			o.glide(oscParams, tuning, next.note, glideParams)
+		}
+		m.gain.init(gain)
+	} else {
+		// the number of voices changes only on the first note
+		m.voices = m.pool[:unisonParams.voices]
+		for u, o := range m.voices {
+			o.initWithNote(oscParams, tuning, next.note, next.velocity)
+			o.detuneRatio, o.pan = unisonParams.voice(u, len(m.voices))
+		}
+		m.gain.init(gain)
+	}
+	m.played = true
+	if prev != nil && !monoParams.retrigger {
+		return enumNoEvent
+	}
+	return enumNoteOn
+}
+func (m *monoOsc) selectNote(priority int) *noteOn {
+	selected := m.activeNotes[0]
+	for _, n := range m.activeNotes[1:] {
+		switch priority {
+		case priorityLow:
+			if n.note < selected.note {
+				selected = n
+			}
+		case priorityHigh:
+			if n.note > selected.note {
+				selected = n
+			}
+		}
 	}
+	return selected
 }
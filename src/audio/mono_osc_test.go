@@ -0,0 +1,49 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestMonoNotePriority(t *testing.T) {
+	p := newParams()
+	tuning := newTuning()
+	m := newMonoOsc()
+	press := func(note int) int {
+		m.activeNotes = append([]*noteOn{{note: note, velocity: 100}}, m.activeNotes...)
+		return m.changeNote(p.oscParams, p.velSense, p.velocityParams, tuning, p.monoParams, p.glideParams, p.unisonParams)
+	}
+	release := func(note int) int {
+		m.removeNote(note)
+		return m.changeNote(p.oscParams, p.velSense, p.velocityParams, tuning, p.monoParams, p.glideParams, p.unisonParams)
+	}
+
+	p.monoParams.priority = priorityLow
+	expectEqual(t, press(60), enumNoteOn)
+	expectEqual(t, press(64), enumNoEvent)
+	expectEqual(t, m.current.note, 60)
+	expectEqual(t, press(55), enumNoEvent) // legato
+	expectEqual(t, m.current.note, 55)
+	expectEqual(t, release(55), enumNoEvent)
+	expectEqual(t, m.current.note, 60)
+
+	p.monoParams.priority = priorityHigh
+	p.monoParams.retrigger = true
+	expectEqual(t, press(67), enumNoteOn)
+	expectEqual(t, m.current.note, 67)
+	expectEqual(t, press(62), enumNoEvent)
+	expectEqual(t, release(67), enumNoteOn)
+	expectEqual(t, m.current.note, 64)
+	release(60)
+	release(62)
+	expectEqual(t, release(64), enumNoteOff)
+	expectEqual(t, m.current == nil, true)
+}
+
+func TestGlideDuration(t *testing.T) {
+	g := newGlideParams()
+	g.time = 50
+	expectNearlyEqual(t, g.duration(440, 880), 50)
+	g.kind = glideConstantRate
+	expectNearlyEqual(t, g.duration(440, 880), 600)
+	expectNearlyEqual(t, g.duration(880, 440), 600)
+}
@@ -0,0 +1,244 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+)
+
+const (
+	defaultBendRange     = 2.0  // semitones
+	defaultNoteBendRange = 48.0 // semitones
+	maxMpeMembers        = 15
+	rpnBendRange         = 0x0000
+	rpnMpeConfiguration  = 0x0006
+	rpnNull              = 0x3fff
+)
+
+// ----- MPE Zone ----- //
+
+// lower zone: master = 1,  members = 2, 3, ...
+// upper zone: master = 16, members = 15, 14, ...
+type mpeZone struct {
+	master          int     // 0 or 15
+	members         int     // 0 ~ 15, 0 means disabled
+	noteBendRange   float64 // semitones, for member channels
+	masterBendRange float64 // semitones, for the master channel
+}
+
+type mpeZoneJSON struct {
+	Members         int     `json:"members"`
+	NoteBendRange   float64 `json:"noteBendRange"`
+	MasterBendRange float64 `json:"masterBendRange"`
+}
+
+func newMpeZone(master int) *mpeZone {
+	return &mpeZone{
+		master:          master,
+		members:         0,
+		noteBendRange:   defaultNoteBendRange,
+		masterBendRange: defaultBendRange,
+	}
+}
+func (z *mpeZone) applyJSON(j *mpeZoneJSON) {
+	if j.Members < 0 || j.Members > maxMpeMembers {
+		log.Println("failed to apply JSON to mpeZone")
+		return
+	}
+	z.members = j.Members
+	z.noteBendRange = j.NoteBendRange
+	z.masterBendRange = j.MasterBendRange
+}
+func (z *mpeZone) toJSON() *mpeZoneJSON {
+	return &mpeZoneJSON{
+		Members:         z.members,
+		NoteBendRange:   z.noteBendRange,
+		MasterBendRange: z.masterBendRange,
+	}
+}
+func (z *mpeZone) set(key string, value string) error {
+	switch key {
+	case "note_bend_range":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		z.noteBendRange = value
+	case "master_bend_range":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		z.masterBendRange = value
+	}
+	return nil
+}
+func (z *mpeZone) enabled() bool {
+	return z.members > 0
+}
+func (z *mpeZone) hasMember(channel int) bool {
+	if !z.enabled() {
+		return false
+	}
+	if z.master == 0 {
+		return channel >= 1 && channel <= z.members
+	}
+	return channel >= z.master-z.members && channel < z.master
+}
+
+// ----- MPE Settings ----- //
+
+type mpeSettings struct {
+	lower *mpeZone
+	upper *mpeZone
+	rpn   [16]int // selected RPN per channel
+}
+
+type mpeJSON struct {
+	Lower *mpeZoneJSON `json:"lower"`
+	Upper *mpeZoneJSON `json:"upper"`
+}
+
+func newMpeSettings() *mpeSettings {
+	s := &mpeSettings{
+		lower: newMpeZone(0),
+		upper: newMpeZone(15),
+	}
+	for i := range s.rpn {
+		s.rpn[i] = rpnNull
+	}
+	return s
+}
+func (s *mpeSettings) applyJSON(j *mpeJSON) {
+	if j.Lower != nil {
+		s.lower.applyJSON(j.Lower)
+	}
+	if j.Upper != nil {
+		s.upper.applyJSON(j.Upper)
+	}
+	s.setMembers(s.lower, s.lower.members)
+}
+func (s *mpeSettings) toJSON() *mpeJSON {
+	return &mpeJSON{
+		Lower: s.lower.toJSON(),
+		Upper: s.upper.toJSON(),
+	}
+}
+func (s *mpeSettings) set(zone string, key string, value string) error {
+	var z *mpeZone
+	switch zone {
+	case "lower":
+		z = s.lower
+	case "upper":
+		z = s.upper
+	default:
+		return fmt.Errorf("unknown MPE zone %v", zone)
+	}
+	if key == "members" {
+		members, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if members < 0 || members > maxMpeMembers {
+			return fmt.Errorf("invalid member channel count %v", value)
+		}
+		s.setMembers(z, int(members))
+		return nil
+	}
+	return z.set(key, value)
+}
+
+// the other zone shrinks when zones overlap (as the MPE spec says)
+func (s *mpeSettings) setMembers(z *mpeZone, members int) {
+	z.members = members
+	other := s.upper
+	if z == s.upper {
+		other = s.lower
+	}
+	if other.members > 14-members {
+		other.members = 14 - members
+		if other.members < 0 {
+			other.members = 0
+		}
+	}
+}
+
+// returns the zone that the channel belongs to, and whether it is the master channel
+func (s *mpeSettings) zoneOf(channel int) (*mpeZone, bool) {
+	for _, z := range []*mpeZone{s.lower, s.upper} {
+		if !z.enabled() {
+			continue
+		}
+		if z.master == channel {
+			return z, true
+		}
+		if z.hasMember(channel) {
+			return z, false
+		}
+	}
+	return nil, false
+}
+
+// member channels are routed to parts as if they came from the master channel
+func (s *mpeSettings) routingChannel(channel int) int {
+	z, _ := s.zoneOf(channel)
+	if z == nil {
+		return channel
+	}
+	return z.master
+}
+
+// returns the bend in semitones, and whether it applies to the whole zone
+func (s *mpeSettings) pitchBend(channel int, value int) (float64, bool) {
+	amount := float64(value-8192) / 8192
+	z, master := s.zoneOf(channel)
+	if z == nil {
+		return amount * defaultBendRange, false
+	}
+	if master {
+		return amount * z.masterBendRange, true
+	}
+	return amount * z.noteBendRange, false
+}
+
+// handles RPN 0 (bend range) and RPN 6 (MPE Configuration Message)
+// returns true if the settings have changed
+func (s *mpeSettings) controlChange(channel int, number int, value int) bool {
+	switch number {
+	case ccRPNMSB:
+		s.rpn[channel] = value<<7 | s.rpn[channel]&0x7f
+	case ccRPNLSB:
+		s.rpn[channel] = s.rpn[channel]&0x3f80 | value
+	case ccDataEntryMSB:
+		switch s.rpn[channel] {
+		case rpnMpeConfiguration:
+			if channel == s.lower.master {
+				s.setMembers(s.lower, clampMembers(value))
+				return true
+			}
+			if channel == s.upper.master {
+				s.setMembers(s.upper, clampMembers(value))
+				return true
+			}
+		case rpnBendRange:
+			z, master := s.zoneOf(channel)
+			if z == nil {
+				return false
+			}
+			if master {
+				z.masterBendRange = float64(value)
+			} else {
+				z.noteBendRange = float64(value)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func clampMembers(value int) int {
+	if value > maxMpeMembers {
+		return maxMpeMembers
+	}
+	return value
+}
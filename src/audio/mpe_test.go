@@ -0,0 +1,38 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestMpeZones(t *testing.T) {
+	s := newMpeSettings()
+	expectEqual(t, s.routingChannel(3), 3)
+	semitones, master := s.pitchBend(3, 16383)
+	expectNearlyEqual(t, semitones, defaultBendRange*8191/8192)
+	expectEqual(t, master, false)
+
+	// MPE Configuration Message: lower zone with 7 members
+	s.controlChange(0, ccRPNMSB, 0)
+	s.controlChange(0, ccRPNLSB, 6)
+	expectEqual(t, s.controlChange(0, ccDataEntryMSB, 7), true)
+	expectEqual(t, s.lower.members, 7)
+	expectEqual(t, s.routingChannel(3), 0)
+	expectEqual(t, s.routingChannel(8), 8)
+	semitones, master = s.pitchBend(3, 0)
+	expectNearlyEqual(t, semitones, -defaultNoteBendRange)
+	expectEqual(t, master, false)
+	semitones, master = s.pitchBend(0, 0)
+	expectNearlyEqual(t, semitones, -defaultBendRange)
+	expectEqual(t, master, true)
+
+	// bend range on a member channel applies to the zone
+	s.controlChange(3, ccRPNMSB, 0)
+	s.controlChange(3, ccRPNLSB, 0)
+	s.controlChange(3, ccDataEntryMSB, 24)
+	expectNearlyEqual(t, s.lower.noteBendRange, 24)
+
+	// the lower zone shrinks when the upper zone overlaps it
+	expectNoError(t, s.set("upper", "members", "10"))
+	expectEqual(t, s.lower.members, 4)
+	expectEqual(t, s.routingChannel(5), 15)
+}
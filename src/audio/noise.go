@@ -0,0 +1,104 @@
+package audio
+
+import (
+	"math/rand"
+)
+
+// ----- Noise Color ----- //
+
+//go:generate go run ../gen/main.go -- noise_color.gen.go
+/*
+generate-enum noiseColor
+
+noiseWhite white
+noisePink pink
+noiseBrown brown
+noiseBlue blue
+noiseVelvet velvet
+
+EOF
+*/
+
+const velvetDensity = 2000 // impulses per second
+
+// ----- Noise ----- //
+
+type noise struct {
+	color int
+	rng   *rand.Rand
+	value float64 // the current value
+	// filter states
+	pink     [7]float64
+	prevPink float64
+	brown    float64
+	velvet   int // samples since the period started
+	impulse  int // position of the impulse in the period
+	sign     float64
+}
+
+func newNoise(seed int64) *noise {
+	return &noise{rng: rand.New(rand.NewSource(seed))}
+}
+
+// seed: 0 for a random seed
+// offset: added to a fixed seed so that each generator has its own sequence
+func (n *noise) init(color int, seed int64, offset int64) {
+	n.color = color
+	if seed == 0 {
+		n.rng.Seed(rand.Int63())
+	} else {
+		n.rng.Seed(seed + offset)
+	}
+	n.pink = [7]float64{}
+	n.prevPink = 0
+	n.brown = 0
+	n.velvet = 0
+	n.step()
+}
+func (n *noise) step() {
+	white := n.rng.Float64()*2 - 1
+	switch n.color {
+	case noiseWhite:
+		n.value = white
+	case noisePink:
+		n.value = n.stepPink(white)
+	case noiseBrown:
+		n.brown = (n.brown + 0.02*white) / 1.02
+		n.value = n.brown * 3.5
+	case noiseBlue:
+		// differentiated pink: +3dB/oct
+		pink := n.stepPink(white)
+		n.value = (pink - n.prevPink) * 0.5
+		n.prevPink = pink
+	case noiseVelvet:
+		// a randomly placed impulse in each period
+		period := sampleRate / velvetDensity
+		if n.velvet%period == 0 {
+			n.velvet = 0
+			n.impulse = n.rng.Intn(period)
+			n.sign = 1
+			if white < 0 {
+				n.sign = -1
+			}
+		}
+		n.value = 0
+		if n.velvet == n.impulse {
+			n.value = n.sign
+		}
+		n.velvet++
+	}
+}
+
+// -3dB/oct by Paul Kellett's method
+func (n *noise) stepPink(white float64) float64 {
+	b := &n.pink
+	b[0] = 0.99886*b[0] + white*0.0555179
+	b[1] = 0.99332*b[1] + white*0.0750759
+	b[2] = 0.96900*b[2] + white*0.1538520
+	b[3] = 0.86650*b[3] + white*0.3104856
+	b[4] = 0.55000*b[4] + white*0.5329522
+	b[5] = -0.7616*b[5] - white*0.0168980
+	pink := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white*0.5362
+	b[6] = white * 0.115926
+	return pink * 0.11
+}
@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// lag-1 autocorrelation
+func noiseCorrelation(color int) float64 {
+	n := newNoise(1)
+	n.init(color, 1, 0)
+	values := make([]float64, sampleRate)
+	for i := range values {
+		n.step()
+		values[i] = n.value
+	}
+	mean := 0.0
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	num := 0.0
+	den := 0.0
+	for i, v := range values {
+		den += (v - mean) * (v - mean)
+		if i > 0 {
+			num += (v - mean) * (values[i-1] - mean)
+		}
+	}
+	return num / den
+}
+
+func TestNoiseColors(t *testing.T) {
+	white := noiseCorrelation(noiseWhite)
+	pink := noiseCorrelation(noisePink)
+	brown := noiseCorrelation(noiseBrown)
+	blue := noiseCorrelation(noiseBlue)
+	expectEqual(t, math.Abs(white) < 0.05, true)
+	expectEqual(t, pink > 0.3, true)
+	expectEqual(t, brown > pink, true)
+	expectEqual(t, blue < 0, true)
+
+	n := newNoise(1)
+	n.init(noiseVelvet, 1, 0)
+	impulses := 0
+	for i := 0; i < sampleRate; i++ {
+		n.step()
+		expectEqual(t, n.value == 0 || math.Abs(n.value) == 1, true)
+		if n.value != 0 {
+			impulses++
+		}
+	}
+	expectEqual(t, impulses, sampleRate/(sampleRate/velvetDensity))
+}
+
+func TestNoiseSeed(t *testing.T) {
+	p := newOscParams()
+	p.enabled = true
+	p.kind = waveSine
+	expectNoError(t, p.set("noise_color", "pink"))
+	expectNoError(t, p.set("noise_mix", "0.5"))
+	expectNoError(t, p.set("noise_seed", "42"))
+	p2 := newOscParams()
+	p2.applyJSON(p.toJSON())
+	expectEqual(t, p2.noiseColor, noisePink)
+	expectEqual(t, p2.noiseMix, 0.5)
+	expectEqual(t, p2.noiseSeed, int64(42))
+
+	// the same output for each note, but different for each voice
+	p.kind = waveNoise
+	v1 := newDecoratedOsc(0)
+	v2 := newDecoratedOsc(1)
+	v1.initWithNote([]*oscParams{p}, newTuning(), 60, 100)
+	v2.initWithNote([]*oscParams{p}, newTuning(), 60, 100)
+	o1 := v1.oscs[0]
+	o2 := v2.oscs[0]
+	values := make([]float64, 100)
+	different := false
+	for i := range values {
+		values[i] = o1.step(1, 0)
+		different = different || o2.step(1, 0) != values[i]
+	}
+	expectEqual(t, different, true)
+	v1.initWithNote([]*oscParams{p}, newTuning(), 60, 100)
+	for i := range values {
+		expectEqual(t, o1.step(1, 0), values[i])
+	}
+	// the phase is still random for the other waves
+	p.kind = waveSine
+	v1.initWithNote([]*oscParams{p}, newTuning(), 60, 100)
+	phase := o1.phase
+	v1.initWithNote([]*oscParams{p}, newTuning(), 60, 100)
+	expectEqual(t, o1.phase != phase, true)
+	// different for each note without seeds
+	p.kind = waveNoise
+	p.noiseSeed = 0
+	v1.initWithNote([]*oscParams{p}, newTuning(), 60, 100)
+	different = false
+	for i := range values {
+		different = different || o1.step(1, 0) != values[i]
+	}
+	expectEqual(t, different, true)
+}
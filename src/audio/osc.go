@@ -25,31 +25,87 @@ waveSaw saw
 waveSawWT saw-wt
 waveSawRev saw-rev
 waveNoise noise
+waveWavetable wavetable
+waveAdditive additive
+waveSample sample
+
+EOF
+*/
+
+// ----- OSC Mod ----- //
+
+// how an oscillator is modulated by osc0
+//go:generate go run ../gen/main.go -- osc_mod.gen.go
+/*
+generate-enum oscMod
+
+oscModNone none
+oscModHardSync hard_sync
+oscModSoftSync soft_sync
+oscModRing ring
+oscModFM fm
 
 EOF
 */
 
 // ----- OSC Params ----- //
 
+const maxOscs = 8
+const minOscs = 2 // the UI always shows osc0 and osc1
+const defaultPulseWidth = 0.25
+
 type oscParams struct {
-	enabled bool
-	kind    int
-	octave  int     // -2 ~ 2
-	coarse  int     // -12 ~ 12
-	fine    int     // -100 ~ 100 cent
-	level   float64 // 0 ~ 1
+	enabled       bool
+	kind          int
+	octave        int     // -2 ~ 2
+	coarse        int     // -12 ~ 12
+	fine          int     // -100 ~ 100 cent
+	level         float64 // 0 ~ 1
+	wavetable     string  // path to a WAV file used by waveWavetable
+	position      float64 // 0 ~ 1
+	interpolation int     // for wavetables
+	pulseWidth    float64 // 0 ~ 1, for wavePulse
+	mod           int
+	fmAmount      float64 // 0 ~ , for oscModFM
+	additive      *additiveParams
+	noiseColor    int
+	noiseMix      float64 // 0 ~ 1, noise mixed into the wave
+	noiseSeed     int64   // 0 for random noise
+	sfz           string  // path to an SFZ file used by waveSample
+	sf2           string  // path to an SF2 file used by waveSample
+	sf2Bank       int
+	sf2Program    int
+	userWavetable *userWavetable
+	instrument    *sampleInstrument
 }
 type oscJSON struct {
-	Enabled bool    `json:"enabled"`
-	Kind    string  `json:"kind"`
-	Octave  int     `json:"octave"`
-	Coarse  int     `json:"coarse"`
-	Fine    int     `json:"fine"`
-	Level   float64 `json:"level"`
+	Enabled       bool            `json:"enabled"`
+	Kind          string          `json:"kind"`
+	Octave        int             `json:"octave"`
+	Coarse        int             `json:"coarse"`
+	Fine          int             `json:"fine"`
+	Level         float64         `json:"level"`
+	Wavetable     string          `json:"wavetable"`
+	Position      float64         `json:"position"`
+	Interpolation string          `json:"interpolation"`
+	PulseWidth    float64         `json:"pulseWidth"`
+	Mod           string          `json:"mod"`
+	FMAmount      float64         `json:"fmAmount"`
+	Additive      json.RawMessage `json:"additive"`
+	NoiseColor    string          `json:"noiseColor"`
+	NoiseMix      float64         `json:"noiseMix"`
+	NoiseSeed     int64           `json:"noiseSeed"`
+	Sfz           string          `json:"sfz"`
+	SF2           string          `json:"sf2"`
+	SF2Bank       int             `json:"sf2Bank"`
+	SF2Program    int             `json:"sf2Program"`
 }
 
+func newOscParams() *oscParams {
+	return &oscParams{enabled: false, kind: waveSine, level: 1.0, pulseWidth: defaultPulseWidth, additive: newAdditiveParams()}
+}
 func (o *oscParams) applyJSON(data json.RawMessage) {
-	var j oscJSON
+	j := oscJSON{PulseWidth: defaultPulseWidth} // for presets without pulseWidth
 	err := json.Unmarshal(data, &j)
 	if err != nil {
 		log.Println("failed to apply JSON to oscParams")
@@ -61,15 +117,54 @@ func (o *oscParams) applyJSON(data json.RawMessage) {
 	o.coarse = j.Coarse
 	o.fine = j.Fine
 	o.level = j.Level
+	o.position = j.Position
+	o.interpolation = interpolationFromString(j.Interpolation)
+	o.pulseWidth = j.PulseWidth
+	o.mod = oscModFromString(j.Mod)
+	o.fmAmount = j.FMAmount
+	if j.Additive != nil {
+		o.additive.applyJSON(j.Additive)
+	}
+	o.noiseColor = noiseColorFromString(j.NoiseColor)
+	o.noiseMix = j.NoiseMix
+	o.noiseSeed = j.NoiseSeed
+	err = o.setWavetable(j.Wavetable)
+	if err != nil {
+		log.Println("failed to load wavetable", j.Wavetable)
+	}
+	err = o.setSfz(j.Sfz)
+	if err != nil {
+		log.Println("failed to load SFZ", j.Sfz, err)
+	}
+	if j.SF2 != "" {
+		err = o.setSF2(j.SF2, j.SF2Bank, j.SF2Program)
+		if err != nil {
+			log.Println("failed to load SF2", j.SF2, err)
+		}
+	}
 }
 func (o *oscParams) toJSON() json.RawMessage {
 	return toRawMessage(&oscJSON{
-		Enabled: o.enabled,
-		Kind:    waveKindToString(o.kind),
-		Octave:  o.octave,
-		Coarse:  o.coarse,
-		Fine:    o.fine,
-		Level:   o.level,
+		Enabled:       o.enabled,
+		Kind:          waveKindToString(o.kind),
+		Octave:        o.octave,
+		Coarse:        o.coarse,
+		Fine:          o.fine,
+		Level:         o.level,
+		Wavetable:     o.wavetable,
+		Position:      o.position,
+		Interpolation: interpolationToString(o.interpolation),
+		PulseWidth:    o.pulseWidth,
+		Mod:           oscModToString(o.mod),
+		FMAmount:      o.fmAmount,
+		Additive:      o.additive.toJSON(),
+		NoiseColor:    noiseColorToString(o.noiseColor),
+		NoiseMix:      o.noiseMix,
+		NoiseSeed:     o.noiseSeed,
+		Sfz:           o.sfz,
+		SF2:           o.sf2,
+		SF2Bank:       o.sf2Bank,
+		SF2Program:    o.sf2Program,
 	})
 }
 func (o *oscParams) set(key string, value string) error {
@@ -102,18 +197,147 @@ func (o *oscParams) set(key string, value string) error {
 			return err
 		}
 		o.level = value
+	case "wavetable":
+		return o.setWavetable(value)
+	case "sfz":
+		return o.setSfz(value)
+	case "noise_color":
+		o.noiseColor = noiseColorFromString(value)
+	case "noise_mix":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.noiseMix = value
+	case "noise_seed":
+		value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		o.noiseSeed = value
+	case "interpolation":
+		o.interpolation = interpolationFromString(value)
+	case "position":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.position = value
+	case "pulse_width":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.pulseWidth = value
+	case "mod":
+		o.mod = oscModFromString(value)
+	case "fm_amount":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		o.fmAmount = value
+	default:
+		return o.additive.set(key, value)
 	}
 	return nil
 }
+func (o *oscParams) continuousParam(key string) *float64 {
+	switch key {
+	case "level":
+		return &o.level
+	case "position":
+		return &o.position
+	case "pulse_width":
+		return &o.pulseWidth
+	case "fm_amount":
+		return &o.fmAmount
+	case "noise_mix":
+		return &o.noiseMix
+	}
+	return o.additive.continuousParam(key)
+}
+
+// "" clears the wavetable
+// (the current one is kept on errors)
+func (o *oscParams) setWavetable(path string) error {
+	if path == "" {
+		o.wavetable = ""
+		o.userWavetable = nil
+		return nil
+	}
+	wt, err := loadUserWavetable(path)
+	if err != nil {
+		return err
+	}
+	o.wavetable = path
+	o.userWavetable = wt
+	return nil
+}
+
+// "" clears the instrument
+// (the current one is kept on errors)
+func (o *oscParams) setSfz(path string) error {
+	if path == "" {
+		o.sfz = ""
+		o.sf2 = ""
+		o.instrument = nil
+		return nil
+	}
+	instrument, err := loadSampleInstrument(path)
+	if err != nil {
+		return err
+	}
+	o.sfz = path
+	o.sf2 = ""
+	o.instrument = instrument
+	return nil
+}
+
+// (the current instrument is kept on errors)
+func (o *oscParams) setSF2(path string, bank int, program int) error {
+	preset, err := loadSF2Preset(path, bank, program)
+	if err != nil {
+		return err
+	}
+	o.sfz = ""
+	o.sf2 = path
+	o.sf2Bank = bank
+	o.sf2Program = program
+	o.instrument = preset.instrument
+	return nil
+}
 
 // ----- OSC ----- //
 
 type osc struct {
-	enabled bool
-	kind    int
-	freq    *transitiveValue
-	level   float64
-	phase   float64
+	enabled       bool
+	kind          int
+	freq          *transitiveValue
+	level         float64
+	phase         float64
+	wavetable     *userWavetable
+	position      float64
+	interpolation int
+	pulseWidth    float64
+	mod           int
+	fmAmount      float64
+	master        *osc // osc0 for the others in decoratedOsc
+	partials      *partials
+	sampler       *samplePlayer
+	noise         *noise
+	noiseMix      float64
+	noiseOffset   int64 // added to the noise seed
+	// set by modulation before step()
+	positionOffset   float64
+	pulseWidthOffset float64
+	// set by step() for slaves
+	out      float64 // value before level
+	wrapped  bool
+	wrapTime float64 // samples from wrap to next sample
+	// sync state
+	direction float64
+	blepNext  float64
 }
 
 func newOsc(enabled bool) *osc {
@@ -123,6 +347,11 @@ func newOsc(enabled bool) *osc {
 		kind:    waveNone,
 		level:   1.0,
 		phase:   rand.Float64() * 2.0 * math.Pi,
+
+		noise:     newNoise(rand.Int63()),
+		partials:  newPartials(),
+		sampler:   newSamplePlayer(),
+		direction: 1,
 	}
 }
 
@@ -142,68 +371,156 @@ func loadWavetableSet(path string) *WavetableSet {
 	}
 	return wts
 }
-func noteWithParamsToFreq(p *oscParams, note int) float64 {
-	return noteToFreq(note) * math.Pow(2, float64(p.octave)+float64(p.coarse)/12+float64(p.fine)/100/12)
+func noteWithParamsToFreq(p *oscParams, tuning *tuning, note int) float64 {
+	return tuning.freq(note) * math.Pow(2, float64(p.octave)+float64(p.coarse)/12+float64(p.fine)/100/12)
 }
-func (o *osc) initWithNote(p *oscParams, note int) {
+func (o *osc) initWithNote(p *oscParams, tuning *tuning, note int, velocity int) {
 	o.enabled = p.enabled
 	o.kind = p.kind
 	o.level = p.level
+	o.wavetable = p.userWavetable
+	o.position = p.position
+	o.interpolation = p.interpolation
+	o.pulseWidth = p.pulseWidth
+	o.mod = p.mod
+	o.fmAmount = p.fmAmount
+	o.noiseMix = p.noiseMix
+	o.noise.init(p.noiseColor, p.noiseSeed, o.noiseOffset)
 	o.phase = rand.Float64() * 2.0 * math.Pi
-	o.freq.init(noteWithParamsToFreq(p, note))
+	o.direction = 1
+	o.blepNext = 0
+	if o.kind == waveAdditive {
+		o.partials.init(p.additive)
+	}
+	if o.kind == waveSample {
+		o.sampler.init(p.instrument, note, velocity)
+	}
+	o.freq.init(noteWithParamsToFreq(p, tuning, note))
 }
-func (o *osc) glide(p *oscParams, note int, glideTime int) {
+func (o *osc) glide(p *oscParams, tuning *tuning, note int, glideParams *glideParams) {
+	if p.kind == waveAdditive && o.kind != waveAdditive {
+		o.partials.init(p.additive)
+	}
+	if p.kind == waveSample {
+		if o.kind != waveSample || o.sampler.instrument != p.instrument {
+			o.sampler.init(p.instrument, note, o.sampler.velocity)
+		} else {
+			o.sampler.selectRegion(note)
+		}
+	}
 	o.enabled = p.enabled
-	nextFreq := noteWithParamsToFreq(p, note)
-	o.freq.linear(float64(glideTime), nextFreq)
+	o.kind = p.kind
+	o.level = p.level
+	o.wavetable = p.userWavetable
+	o.position = p.position
+	o.interpolation = p.interpolation
+	o.pulseWidth = p.pulseWidth
+	o.mod = p.mod
+	o.fmAmount = p.fmAmount
+	o.noiseMix = p.noiseMix
+	o.noise.color = p.noiseColor
+	nextFreq := noteWithParamsToFreq(p, tuning, note)
+	o.freq.linear(glideParams.duration(o.freq.value, nextFreq), nextFreq)
 }
 func (o *osc) step(freqRatio float64, phaseShift float64) float64 {
+	o.out = 0
+	o.wrapped = false
 	if !o.enabled {
 		return 0.0
 	}
 	o.freq.step()
 	freq := o.freq.value * freqRatio
+	master := o.master
+	if master != nil && o.mod == oscModFM {
+		freq *= 1 + master.out*o.fmAmount // through-zero
+	}
 	phase := o.phase + phaseShift
+	dt := freq / float64(sampleRate) // phase increment (0 ~ 1)
+	if o.mod == oscModSoftSync {
+		dt *= o.direction
+	}
+	value := o.valueAt(phase, math.Abs(freq), math.Abs(dt)) + o.blepNext
+	o.blepNext = 0
+	if master != nil && master.wrapped && o.mod == oscModHardSync {
+		// reset at the time of wrap, smoothing the jump with PolyBLEP across 2 samples
+		t := master.wrapTime
+		before := o.valueAt(phase+2.0*math.Pi*dt*(1-t), math.Abs(freq), 0)
+		o.phase = 0
+		o.partials.reset()
+		o.sampler.position = 0
+		after := o.valueAt(phaseShift, math.Abs(freq), 0)
+		h := after - before
+		value += h * t * t / 2
+		o.blepNext = -h * (1 - t) * (1 - t) / 2
+		o.phase = 2.0 * math.Pi * dt * t
+		o.advance(dt * t * float64(sampleRate))
+	} else {
+		prev := o.phase
+		o.phase += 2.0 * math.Pi * dt
+		o.advance(dt * float64(sampleRate))
+		if dt > 0 && math.Floor(o.phase/(2.0*math.Pi)) != math.Floor(prev/(2.0*math.Pi)) {
+			o.wrapped = true
+			o.wrapTime = positiveMod(o.phase/(2.0*math.Pi), 1) / dt
+		}
+	}
+	if master != nil && master.wrapped && o.mod == oscModSoftSync {
+		o.direction = -o.direction // reversing
+	}
+	if o.noiseMix > 0 {
+		value = value*(1-o.noiseMix) + o.noise.value*o.noiseMix
+	}
+	if master != nil && o.mod == oscModRing {
+		value *= master.out
+	}
+	o.out = value
+	return value * o.level
+}
+
+// dt: phase increment (0 ~ 1) for band-limiting, 0 for naive waves
+func (o *osc) valueAt(phase float64, freq float64, dt float64) float64 {
 	value := 0.0
 	switch o.kind {
 	case waveSine:
 		value = math.Sin(phase)
 	case waveTriangle:
-		p := positiveMod(phase/(2.0*math.Pi), 1)
-		if p < 0.5 {
-			value = p*4 - 1
-		} else {
-			value = p*(-4) + 3
-		}
+		value = blTriangle(positiveMod(phase/(2.0*math.Pi), 1), dt)
 	case waveSquare:
-		p := positiveMod(phase/(2.0*math.Pi), 1)
-		if p < 0.5 {
-			value = 1
-		} else {
-			value = -1
-		}
+		value = blPulse(positiveMod(phase/(2.0*math.Pi), 1), dt, 0.5)
 	case waveSquareWT:
-		note := freqToNote(freq)
-		value = blsquareWT.tables[note].getAtPhase(phase)
+		value = blsquareWT.getAtFreq(freq, phase, o.interpolation)
 	case wavePulse:
-		p := positiveMod(phase/(2.0*math.Pi), 1)
-		if p < 0.25 {
-			value = 1
-		} else {
-			value = -1
-		}
+		width := o.pulseWidth + o.pulseWidthOffset
+		value = blPulse(positiveMod(phase/(2.0*math.Pi), 1), dt, width)
 	case waveSaw:
-		p := positiveMod(phase/(2.0*math.Pi), 1)
-		value = p*2 - 1
+		value = blSaw(positiveMod(phase/(2.0*math.Pi), 1), dt)
 	case waveSawWT:
-		note := freqToNote(freq)
-		value = blsawWT.tables[note].getAtPhase(phase)
+		value = blsawWT.getAtFreq(freq, phase, o.interpolation)
 	case waveSawRev:
-		p := positiveMod(phase/(2.0*math.Pi), 1)
-		value = p*(-2) + 1
+		value = -blSaw(positiveMod(phase/(2.0*math.Pi), 1), dt)
 	case waveNoise:
-		value = rand.Float64()*2 - 1
+		value = o.noise.value
+	case waveWavetable:
+		if o.wavetable != nil {
+			value = o.wavetable.getAtFreq(o.position+o.positionOffset, freq, phase, o.interpolation)
+		}
+	case waveAdditive:
+		// each partial has its own phase
+		value = o.partials.valueAt(freq, phase-o.phase)
+	case waveSample:
+		value = o.sampler.valueAt(o.interpolation)
+	}
+	return value
+}
+
+// advances the sources that have their own states
+func (o *osc) advance(freq float64) {
+	switch o.kind {
+	case waveAdditive:
+		o.partials.advance(freq)
+	case waveSample:
+		o.sampler.advance(freq)
+	}
+	if o.kind == waveNoise || o.noiseMix > 0 {
+		o.noise.step()
 	}
-	o.phase += 2.0 * math.Pi * freq / float64(sampleRate)
-	return value * o.level
 }
@@ -0,0 +1,123 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOscCount(t *testing.T) {
+	p := newParams()
+	expectNoError(t, p.setOscCount(maxOscs))
+	expectEqual(t, len(p.oscParams), maxOscs)
+	expectEqual(t, p.oscParams[0].enabled, true)
+	expectEqual(t, p.oscParams[maxOscs-1].enabled, false)
+	expectEqual(t, p.setOscCount(maxOscs+1) != nil, true)
+	expectEqual(t, p.setOscCount(1) != nil, true)
+
+	p.oscParams[7].enabled = true
+	p.oscParams[7].level = 0.5
+	data := p.toJSON()
+	p2 := newParams()
+	p2.applyJSON(data)
+	expectEqual(t, len(p2.oscParams), maxOscs)
+	expectEqual(t, p2.oscParams[7].level, 0.5)
+
+	o := newDecoratedOsc(0)
+	o.initWithNote(p2.oscParams, newTuning(), 60, 127)
+	expectEqual(t, len(o.oscs), maxOscs)
+	expectEqual(t, o.oscs[7].enabled, true)
+	expectNoError(t, p2.setOscCount(3))
+	o.initWithNote(p2.oscParams, newTuning(), 60, 127)
+	expectEqual(t, len(o.oscs), 3)
+
+	// resized while sounding
+	p2.oscParams[0].kind = waveSine
+	expectNoError(t, p2.setOscCount(4))
+	p2.oscParams[3].enabled = true
+	o.applyParams(p2.oscParams, p2.fmParams, p2.adsrParams, p2.noteFilterParams, p2.filterParams, p2.formantParams, p2.lfoParams, p2.envelopeParams, p2.expressionParams, newTuning(), defaultBpm)
+	expectEqual(t, len(o.oscs), 4)
+	expectEqual(t, o.oscs[3].enabled, true)
+	expectNearlyEqual(t, o.oscs[3].freq.value, o.oscs[0].freq.value)
+	expectNoError(t, p2.setOscCount(2))
+	o.applyParams(p2.oscParams, p2.fmParams, p2.adsrParams, p2.noteFilterParams, p2.filterParams, p2.formantParams, p2.lfoParams, p2.envelopeParams, p2.expressionParams, newTuning(), defaultBpm)
+	expectEqual(t, len(o.oscs), 2)
+
+	expectEqual(t, destinationFromString("osc7_volume"), destOscVolume[7])
+	expectEqual(t, targetOscFromString("7"), targetOscs[7])
+}
+
+func newTestOscPair(kind int, mod int, ratio float64) (*osc, *osc) {
+	master := newOsc(true)
+	master.kind = waveSaw
+	master.freq.init(110)
+	slave := newOsc(true)
+	slave.kind = kind
+	slave.mod = mod
+	slave.freq.init(110 * ratio)
+	slave.master = master
+	// not random, so that the results are stable
+	master.phase = 0
+	slave.phase = 0
+	return master, slave
+}
+
+func TestOscMod(t *testing.T) {
+	// hard sync: the slave restarts when the master wraps
+	master, slave := newTestOscPair(waveSaw, oscModHardSync, 2.7)
+	wraps := 0
+	for i := 0; i < sampleRate/10; i++ {
+		master.step(1, 0)
+		slave.step(1, 0)
+		if master.wrapped {
+			wraps++
+			expectEqual(t, slave.phase < 2*math.Pi*slave.freq.value/sampleRate, true)
+		}
+	}
+	expectEqual(t, wraps, 11)
+
+	// soft sync: the slave reverses when the master wraps
+	master, slave = newTestOscPair(waveSine, oscModSoftSync, 2.7)
+	for !master.wrapped {
+		master.step(1, 0)
+		slave.step(1, 0)
+	}
+	expectEqual(t, slave.direction, -1.0)
+
+	// ring
+	master, slave = newTestOscPair(waveSine, oscModRing, 1.5)
+	reference := newOsc(true)
+	reference.kind = waveSine
+	reference.freq.init(110 * 1.5)
+	reference.phase = slave.phase
+	for i := 0; i < 100; i++ {
+		m := master.step(1, 0)
+		expectNearlyEqual(t, slave.step(1, 0), reference.step(1, 0)*m)
+	}
+
+	// FM with no amount
+	master, slave = newTestOscPair(waveSine, oscModFM, 1.5)
+	reference.phase = slave.phase
+	for i := 0; i < 100; i++ {
+		master.step(1, 0)
+		expectNearlyEqual(t, slave.step(1, 0), reference.step(1, 0))
+	}
+	slave.fmAmount = 1
+	for i := 0; i < 2; i++ {
+		master.step(1, 0)
+		slave.step(1, 0)
+		reference.step(1, 0)
+	}
+	master.step(1, 0)
+	expectEqual(t, math.Abs(slave.step(1, 0)-reference.step(1, 0)) > 0.001, true)
+
+	p := newOscParams()
+	expectNoError(t, p.set("mod", "hard_sync"))
+	expectNoError(t, p.set("fm_amount", "0.5"))
+	p2 := newOscParams()
+	p2.applyJSON(p.toJSON())
+	expectEqual(t, p2.mod, oscModHardSync)
+	expectEqual(t, p2.fmAmount, 0.5)
+	o := newDecoratedOsc(0)
+	expectEqual(t, o.oscPool[1].master, o.oscPool[0])
+	expectEqual(t, o.oscPool[0].master == nil, true)
+}
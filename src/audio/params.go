@@ -2,53 +2,102 @@ package audio
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"strconv"
 )
 
 type params struct {
 	polyMode         bool
-	glideTime        int     // ms
+	monoParams       *monoParams
+	glideParams      *glideParams
+	unisonParams     *unisonParams
 	velSense         float64 // 0-1
+	velocityParams   *velocityParams
 	oscParams        []*oscParams
+	fmParams         *fmParams
 	adsrParams       *adsrParams
 	noteFilterParams *noteFilterParams
 	filterParams     *filterParams
 	formantParams    *formantParams
 	lfoParams        []*lfoParams
 	envelopeParams   []*envelopeParams
+	expressionParams *expressionParams
+	arpParams        *arpParams
+	seqParams        *seqParams
 	echoParams       *echoParams
 }
 
 func newParams() *params {
-	return &params{
-		oscParams:        []*oscParams{{enabled: true, kind: waveSine, level: 1.0}, {enabled: false, kind: waveSine, level: 1.0}},
+	p := &params{
+		oscParams:        []*oscParams{newOscParams(), newOscParams()},
+		fmParams:         newFMParams(),
 		adsrParams:       &adsrParams{attack: 10, decay: 100, sustain: 0.7, release: 200},
 		lfoParams:        []*lfoParams{newLfoParams(), newLfoParams(), newLfoParams()},
 		noteFilterParams: &noteFilterParams{kind: filterNone, q: 1, gain: 0},
 		filterParams:     &filterParams{kind: filterNone, freq: 1000, q: 1, gain: 0, N: 50},
 		formantParams:    &formantParams{kind: formantA, tone: 1, q: 1},
 		envelopeParams:   []*envelopeParams{newEnvelopeParams(), newEnvelopeParams(), newEnvelopeParams()},
-		echoParams:       &echoParams{},
+		expressionParams: newExpressionParams(),
+		arpParams:        newArpParams(),
+		seqParams:        newSeqParams(),
+		echoParams:       newEchoParams(),
 		polyMode:         false,
-		glideTime:        100,
+		monoParams:       newMonoParams(),
+		glideParams:      newGlideParams(),
+		unisonParams:     newUnisonParams(),
 		velSense:         0,
+		velocityParams:   newVelocityParams(),
 	}
+	p.oscParams[0].enabled = true
+	return p
 }
 
 type paramsJSON struct {
 	Poly       string            `json:"poly"`
 	GlideTime  int               `json:"glideTime"`
+	Mono       json.RawMessage   `json:"mono"`
+	Glide      json.RawMessage   `json:"glide"`
+	Unison     json.RawMessage   `json:"unison"`
 	VelSense   float64           `json:"velSense"`
+	Velocity   json.RawMessage   `json:"velocity"`
 	Oscs       []json.RawMessage `json:"oscs"`
+	FM         json.RawMessage   `json:"fm"`
 	Adsr       json.RawMessage   `json:"adsr"`
 	NoteFilter json.RawMessage   `json:"noteFilter"`
 	Filter     json.RawMessage   `json:"filter"`
 	Formant    json.RawMessage   `json:"formant"`
 	Lfos       []json.RawMessage `json:"lfos"`
 	Envelopes  []json.RawMessage `json:"envelopes"`
+	Expression json.RawMessage   `json:"expression"`
+	Arp        json.RawMessage   `json:"arpeggiator"`
+	Seq        json.RawMessage   `json:"sequencer"`
 	Echo       json.RawMessage   `json:"echo"`
 }
 
+// loads files referenced by the JSON into the caches before locking the state,
+// so that applyJSON() does not block the audio thread (errors are reported by applyJSON)
+func preloadParamsFiles(data json.RawMessage) {
+	var j paramsJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return
+	}
+	for _, data := range j.Oscs {
+		var o oscJSON
+		if err := json.Unmarshal(data, &o); err != nil {
+			continue
+		}
+		if o.Wavetable != "" {
+			loadUserWavetable(o.Wavetable)
+		}
+		if o.Sfz != "" {
+			loadSampleInstrument(o.Sfz)
+		}
+		if o.SF2 != "" {
+			loadSoundFont(o.SF2)
+		}
+	}
+}
 func (p *params) applyJSON(data json.RawMessage) {
 	var j paramsJSON
 	err := json.Unmarshal(data, &j)
@@ -59,15 +108,35 @@ func (p *params) applyJSON(data json.RawMessage) {
 		return
 	}
 	p.polyMode = j.Poly == "poly"
-	p.glideTime = j.GlideTime
+	p.glideParams.time = j.GlideTime
+	if j.Mono != nil {
+		p.monoParams.applyJSON(j.Mono)
+	}
+	if j.Glide != nil {
+		p.glideParams.applyJSON(j.Glide)
+	}
+	if j.Unison != nil {
+		p.unisonParams.applyJSON(j.Unison)
+	}
 	p.velSense = j.VelSense
-	if len(j.Oscs) == len(p.oscParams) {
+	if j.Velocity != nil {
+		p.velocityParams.applyJSON(j.Velocity)
+	}
+	if len(j.Oscs) >= 1 && len(j.Oscs) <= maxOscs {
+		count := len(j.Oscs)
+		if count < minOscs {
+			count = minOscs
+		}
+		p.setOscCount(count)
 		for i, j := range j.Oscs {
 			p.oscParams[i].applyJSON(j)
 		}
 	} else {
 		log.Println("failed to apply JSON to osc params")
 	}
+	if j.FM != nil {
+		p.fmParams.applyJSON(j.FM)
+	}
 	p.adsrParams.applyJSON(j.Adsr)
 	p.noteFilterParams.applyJSON(j.NoteFilter)
 	p.filterParams.applyJSON(j.Filter)
@@ -86,8 +155,27 @@ func (p *params) applyJSON(data json.RawMessage) {
 	} else {
 		log.Println("failed to apply JSON to envelope params")
 	}
+	if j.Expression != nil {
+		p.expressionParams.applyJSON(j.Expression)
+	}
+	if j.Arp != nil {
+		p.arpParams.applyJSON(j.Arp)
+	}
+	if j.Seq != nil {
+		p.seqParams.applyJSON(j.Seq)
+	}
 	p.echoParams.applyJSON(j.Echo)
 }
+func (p *params) setOscCount(count int) error {
+	if count < minOscs || count > maxOscs {
+		return fmt.Errorf("invalid number of oscillators %v", count)
+	}
+	for len(p.oscParams) < count {
+		p.oscParams = append(p.oscParams, newOscParams())
+	}
+	p.oscParams = p.oscParams[:count]
+	return nil
+}
 func (p *params) toJSON() json.RawMessage {
 	oscJsons := make([]json.RawMessage, len(p.oscParams))
 	for i, oscParam := range p.oscParams {
@@ -107,15 +195,101 @@ func (p *params) toJSON() json.RawMessage {
 	}
 	return toRawMessage(&paramsJSON{
 		Poly:       poly,
-		GlideTime:  p.glideTime,
+		GlideTime:  p.glideParams.time,
+		Mono:       p.monoParams.toJSON(),
+		Glide:      p.glideParams.toJSON(),
+		Unison:     p.unisonParams.toJSON(),
 		VelSense:   p.velSense,
+		Velocity:   p.velocityParams.toJSON(),
 		Oscs:       oscJsons,
+		FM:         p.fmParams.toJSON(),
 		Adsr:       p.adsrParams.toJSON(),
 		NoteFilter: p.noteFilterParams.toJSON(),
 		Filter:     p.filterParams.toJSON(),
 		Formant:    p.formantParams.toJSON(),
 		Lfos:       lfoJsons,
 		Envelopes:  envelopeJsons,
+		Expression: p.expressionParams.toJSON(),
+		Arp:        p.arpParams.toJSON(),
+		Seq:        p.seqParams.toJSON(),
 		Echo:       p.echoParams.toJSON(),
 	})
 }
+
+// returns a pointer to a continuous parameter addressed in the same way as "set" commands
+func (p *params) continuousParam(path []string) (*float64, error) {
+	var value *float64
+	switch {
+	case len(path) == 1 && path[0] == "vel_sense":
+		value = &p.velSense
+	case len(path) == 3 && path[0] == "osc":
+		index, err := parseIndex(path[1], len(p.oscParams))
+		if err != nil {
+			return nil, err
+		}
+		value = p.oscParams[index].continuousParam(path[2])
+	case len(path) == 3 && path[0] == "osc_partial":
+		index, err := parseIndex(path[1], len(p.oscParams))
+		if err != nil {
+			return nil, err
+		}
+		n, err := parseIndex(path[2], maxPartials)
+		if err != nil {
+			return nil, err
+		}
+		value = &p.oscParams[index].additive.partials[n]
+	case len(path) == 2 && path[0] == "fm":
+		value = p.fmParams.continuousParam(path[1])
+	case len(path) == 3 && path[0] == "fm_op":
+		index, err := parseIndex(path[1], len(p.fmParams.operators))
+		if err != nil {
+			return nil, err
+		}
+		value = p.fmParams.operators[index].continuousParam(path[2])
+	case len(path) == 2 && path[0] == "unison":
+		value = p.unisonParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "velocity":
+		value = p.velocityParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "adsr":
+		value = p.adsrParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "note_filter":
+		value = p.noteFilterParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "filter":
+		value = p.filterParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "formant":
+		value = p.formantParams.continuousParam(path[1])
+	case len(path) == 3 && path[0] == "lfo":
+		index, err := parseIndex(path[1], len(p.lfoParams))
+		if err != nil {
+			return nil, err
+		}
+		value = p.lfoParams[index].continuousParam(path[2])
+	case len(path) == 3 && path[0] == "envelope":
+		index, err := parseIndex(path[1], len(p.envelopeParams))
+		if err != nil {
+			return nil, err
+		}
+		value = p.envelopeParams[index].continuousParam(path[2])
+	case len(path) == 2 && path[0] == "expression":
+		value = p.expressionParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "arpeggiator":
+		value = p.arpParams.continuousParam(path[1])
+	case len(path) == 2 && path[0] == "echo":
+		value = p.echoParams.continuousParam(path[1])
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%v is not a continuous parameter", path)
+	}
+	return value, nil
+}
+
+func parseIndex(s string, length int) (int, error) {
+	index, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 || int(index) >= length {
+		return 0, fmt.Errorf("index out of range: %v", s)
+	}
+	return int(index), nil
+}
@@ -0,0 +1,273 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+const (
+	maxParts    = 16
+	channelOmni = -1
+)
+
+func channelFromString(s string) (int, error) {
+	if s == "omni" {
+		return channelOmni, nil
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value < 1 || value > 16 {
+		return 0, fmt.Errorf("invalid MIDI channel %v", s)
+	}
+	return int(value) - 1, nil
+}
+func channelToString(channel int) string {
+	if channel == channelOmni {
+		return "omni"
+	}
+	return strconv.Itoa(channel + 1)
+}
+
+// ----- Mix Params ----- //
+
+type mixParams struct {
+	enabled bool
+	channel int     // 0 ~ 15, or channelOmni
+	level   float64 // 0 ~ 1
+	pan     float64 // -1 ~ 1
+}
+
+type mixJSON struct {
+	Enabled bool    `json:"enabled"`
+	Channel string  `json:"channel"`
+	Level   float64 `json:"level"`
+	Pan     float64 `json:"pan"`
+}
+
+func newMixParams(index int) *mixParams {
+	if index == 0 {
+		return &mixParams{enabled: true, channel: channelOmni, level: 1.0}
+	}
+	return &mixParams{enabled: false, channel: index, level: 1.0}
+}
+func (m *mixParams) applyJSON(data json.RawMessage) {
+	var j mixJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to mixParams")
+		return
+	}
+	channel, err := channelFromString(j.Channel)
+	if err != nil {
+		log.Println("failed to apply JSON to mixParams")
+		return
+	}
+	m.enabled = j.Enabled
+	m.channel = channel
+	m.level = j.Level
+	m.pan = j.Pan
+}
+func (m *mixParams) toJSON() json.RawMessage {
+	return toRawMessage(&mixJSON{
+		Enabled: m.enabled,
+		Channel: channelToString(m.channel),
+		Level:   m.level,
+		Pan:     m.pan,
+	})
+}
+func (m *mixParams) set(key string, value string) error {
+	switch key {
+	case "enabled":
+		m.enabled = value == "true"
+	case "channel":
+		channel, err := channelFromString(value)
+		if err != nil {
+			return err
+		}
+		m.channel = channel
+	case "level":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		m.level = value
+	case "pan":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		m.pan = value
+	}
+	return nil
+}
+func (m *mixParams) accepts(channel int) bool {
+	return m.enabled && (m.channel == channelOmni || m.channel == channel)
+}
+
+// balanced so that a centered part keeps its full level on both sides
+func (m *mixParams) gains() (float64, float64) {
+	left := m.level
+	right := m.level
+	if m.pan > 0 {
+		left *= 1 - m.pan
+	} else {
+		right *= 1 + m.pan
+	}
+	return left, right
+}
+
+// ----- Part ----- //
+
+type part struct {
+	*params
+	mix     *mixParams
+	running bool // whether calc() ran in the last cycle
+	preset  string
+	bankMSB int
+	bankLSB int
+	events  [][]*midiEvent // length: samplesPerCycle * 2
+	seq     *sequencer
+	arp     *arpeggiator
+	monoOsc *monoOsc
+	polyOsc *polyOsc
+	echoes  []*echo               // per channel
+	out     [channelNum][]float64 // length: samplesPerCycle
+}
+
+func newPart(index int) *part {
+	return &part{
+		params:  newParams(),
+		mix:     newMixParams(index),
+		events:  make([][]*midiEvent, samplesPerCycle*2),
+		seq:     newSequencer(),
+		arp:     newArpeggiator(),
+		monoOsc: newMonoOsc(),
+		polyOsc: newPolyOsc(),
+		echoes:  []*echo{{delay: &delay{}}, {delay: &delay{}}},
+		out:     [channelNum][]float64{make([]float64, samplesPerCycle), make([]float64, samplesPerCycle)},
+	}
+}
+
+func (p *part) selectBank(number int, value int) {
+	switch number {
+	case ccBankSelectMSB:
+		p.bankMSB = value
+	case ccBankSelectLSB:
+		p.bankLSB = value
+	}
+}
+func (p *part) bank() int {
+	return p.bankMSB<<7 | p.bankLSB
+}
+
+// send: receives notes generated by the sequencer and the arpeggiator
+func (p *part) calc(bpm float64, tuning *tuning, outL []float64, outR []float64, send func(data []byte)) {
+	p.seq.process(p.events, len(outL), p.seqParams, bpm, p.mix.channel, send)
+	p.arp.process(p.events, len(outL), p.arpParams, bpm, send)
+	// split at the steps so that each step's locks start with its note
+	p.seq.calcWithLocks(p.params, len(outL), func(start int, end int) {
+		events := p.events[start:]
+		outL := outL[start:end]
+		outR := outR[start:end]
+		for _, echo := range p.echoes {
+			echo.applyParams(p.echoParams, bpm)
+		}
+		if p.polyMode {
+			p.polyOsc.calc(events, p.oscParams, p.fmParams, p.adsrParams, p.noteFilterParams, p.filterParams, p.formantParams, p.lfoParams, p.envelopeParams, p.expressionParams, p.velSense, p.velocityParams, tuning, p.glideParams, p.unisonParams, bpm, p.echoes, outL, outR)
+		} else {
+			p.monoOsc.calc(events, p.oscParams, p.fmParams, p.adsrParams, p.noteFilterParams, p.filterParams, p.formantParams, p.lfoParams, p.envelopeParams, p.expressionParams, p.velSense, p.velocityParams, tuning, p.monoParams, p.glideParams, p.unisonParams, bpm, p.echoes, outL, outR)
+		}
+	})
+}
+
+func (p *part) shiftEvents() {
+	eventLength := len(p.events)
+	for i := 0; i < eventLength; i++ {
+		if i >= eventLength/2 {
+			p.events[i-eventLength/2] = p.events[i]
+		}
+		p.events[i] = nil
+	}
+}
+
+type partJSON struct {
+	Preset *string         `json:"preset"`
+	Mix    json.RawMessage `json:"mix"`
+	Params json.RawMessage `json:"params"`
+}
+
+func (p *part) applyJSON(data json.RawMessage) {
+	var j partJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to part")
+		return
+	}
+	p.preset = ""
+	if j.Preset != nil {
+		p.preset = *j.Preset
+	}
+	p.mix.applyJSON(j.Mix)
+	p.params.applyJSON(j.Params)
+}
+func (p *part) toJSON() json.RawMessage {
+	var presetOrNull *string
+	if p.preset != "" {
+		presetOrNull = &p.preset
+	}
+	return toRawMessage(&partJSON{
+		Preset: presetOrNull,
+		Mix:    p.mix.toJSON(),
+		Params: p.params.toJSON(),
+	})
+}
+
+// ----- Session ----- //
+
+type sessionJSON struct {
+	Selected int               `json:"selected"`
+	Parts    []json.RawMessage `json:"parts"`
+	Midi     json.RawMessage   `json:"midi"`
+	Tuning   json.RawMessage   `json:"tuning"`
+}
+
+func (s *state) applyJSON(data json.RawMessage) {
+	var j sessionJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to session")
+		return
+	}
+	if len(j.Parts) == len(s.parts) {
+		for i, j := range j.Parts {
+			s.parts[i].applyJSON(j)
+		}
+	} else {
+		log.Println("failed to apply JSON to parts")
+	}
+	if j.Selected >= 0 && j.Selected < len(s.parts) {
+		s.selected = j.Selected
+	}
+	if j.Midi != nil {
+		s.midi.applyJSON(j.Midi)
+	}
+	if j.Tuning != nil {
+		s.tuning.applyJSON(j.Tuning)
+	}
+}
+func (s *state) toJSON() json.RawMessage {
+	partJsons := make([]json.RawMessage, len(s.parts))
+	for i, part := range s.parts {
+		partJsons[i] = part.toJSON()
+	}
+	return toRawMessage(&sessionJSON{
+		Selected: s.selected,
+		Parts:    partJsons,
+		Midi:     s.midi.toJSON(),
+		Tuning:   s.tuning.toJSON(),
+	})
+}
@@ -0,0 +1,85 @@
+package audio
+
+// ----- Pedal ----- //
+
+/*
+  sustain:   every note-off is deferred while the pedal is down
+  sostenuto: only note-offs of the keys held when the pedal went down are deferred
+*/
+type pedal struct {
+	sustain   bool
+	sostenuto bool
+	held      [128]bool // keys physically pressed
+	caught    [128]bool // keys caught by sostenuto
+	deferred  [128]bool // notes whose note-off is waiting for pedal release
+	released  []int
+}
+
+func newPedal() *pedal {
+	return &pedal{
+		released: make([]int, 0, 128),
+	}
+}
+
+func (p *pedal) reset() {
+	p.sustain = false
+	p.sostenuto = false
+	p.held = [128]bool{}
+	p.caught = [128]bool{}
+	p.deferred = [128]bool{}
+}
+
+// returns true if the note was still sounding only because of the pedal
+func (p *pedal) noteOn(note int) bool {
+	if note < 0 || note >= 128 {
+		return false
+	}
+	p.held[note] = true
+	retriggered := p.deferred[note]
+	p.deferred[note] = false
+	return retriggered
+}
+
+// returns true if the note-off should be deferred
+func (p *pedal) noteOff(note int) bool {
+	if note < 0 || note >= 128 {
+		return false
+	}
+	p.held[note] = false
+	if p.sustain || p.sostenuto && p.caught[note] {
+		p.deferred[note] = true
+		return true
+	}
+	return false
+}
+
+// returns notes to be released now (valid until the next call)
+func (p *pedal) controlChange(number int, value int) []int {
+	p.released = p.released[:0]
+	on := value >= 64
+	switch number {
+	case ccSustain:
+		p.sustain = on
+	case ccSostenuto:
+		if on && !p.sostenuto {
+			for note, held := range p.held {
+				p.caught[note] = held
+			}
+		}
+		if !on {
+			for note := range p.caught {
+				p.caught[note] = false
+			}
+		}
+		p.sostenuto = on
+	default:
+		return p.released
+	}
+	for note, deferred := range p.deferred {
+		if deferred && !p.sustain && !(p.sostenuto && p.caught[note]) {
+			p.deferred[note] = false
+			p.released = append(p.released, note)
+		}
+	}
+	return p.released
+}
@@ -0,0 +1,33 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestSustainPedal(t *testing.T) {
+	p := newPedal()
+	p.noteOn(60)
+	expectEqual(t, len(p.controlChange(ccSustain, 127)), 0)
+	expectEqual(t, p.noteOff(60), true)
+	expectEqual(t, p.noteOn(60), true)
+	expectEqual(t, p.noteOff(60), true)
+	released := p.controlChange(ccSustain, 0)
+	expectEqual(t, len(released), 1)
+	expectEqual(t, released[0], 60)
+	expectEqual(t, p.noteOff(60), false)
+}
+
+func TestSostenutoPedal(t *testing.T) {
+	p := newPedal()
+	p.noteOn(60)
+	p.controlChange(ccSostenuto, 127)
+	p.noteOn(64)
+	expectEqual(t, p.noteOff(60), true)
+	expectEqual(t, p.noteOff(64), false)
+	p.controlChange(ccSustain, 127)
+	released := p.controlChange(ccSostenuto, 0)
+	expectEqual(t, len(released), 0)
+	released = p.controlChange(ccSustain, 0)
+	expectEqual(t, len(released), 1)
+	expectEqual(t, released[0], 60)
+}
@@ -2,83 +2,233 @@ package audio
 
 import (
 	"log"
+	"math"
 )
 
 type polyOsc struct {
 	// pooled + active = maxPoly
 	pooled []*noteOsc
 	active []*noteOsc
+	pedal  *pedal
+	// the latest values per channel, which a new note on that channel starts with
+	channels   [16]expressionValues
+	masterBend float64
+	lastNote   int // the latest note played, -1 if none
 }
 
 type noteOsc struct {
 	*decoratedOsc
 	note     int
+	channel  int
 	velocity int
+	event    int
+	unison   int // index in the unison voices
+	voices   int // number of the unison voices of the note
 }
 
 func newPolyOsc() *polyOsc {
 	pooled := make([]*noteOsc, maxPoly)
 	for i := 0; i < len(pooled); i++ {
 		pooled[i] = &noteOsc{
-			decoratedOsc: newDecoratedOsc(),
+			decoratedOsc: newDecoratedOsc(i),
 		}
 	}
 	return &polyOsc{
-		pooled: pooled,
+		pooled:   pooled,
+		pedal:    newPedal(),
+		lastNote: -1,
 	}
 }
+
+// channelOmni matches notes on any channel
+func (p *polyOsc) noteOff(note int, channel int, releaseRatio float64) {
+	for _, o := range p.active {
+		if o.note == note && (channel == channelOmni || o.channel == channel) {
+			o.event = enumNoteOff
+			o.releaseRatio = releaseRatio
+		}
+	}
+}
+func (o *noteOsc) held() bool {
+	switch o.event {
+	case enumNoteOn:
+		return true
+	case enumNoteOff:
+		return false
+	}
+	return o.adsr.phase != phaseRelease && o.adsr.phase != phaseNone
+}
+
+// returns the note a new voice glides from, -1 if none
+func (p *polyOsc) glideSource(note int, glideParams *glideParams) int {
+	if glideParams.poly == polyGlideOff {
+		return -1
+	}
+	held := false
+	nearest := -1
+	for _, o := range p.active {
+		if !o.held() {
+			continue
+		}
+		held = true
+		if nearest < 0 || math.Abs(float64(o.note-note)) < math.Abs(float64(nearest-note)) {
+			nearest = o.note
+		}
+	}
+	if glideParams.legatoOnly && !held {
+		return -1
+	}
+	if glideParams.poly == polyGlideNearest && nearest >= 0 {
+		return nearest
+	}
+	return p.lastNote
+}
 func (p *polyOsc) calc(
 	events [][]*midiEvent,
 	oscParams []*oscParams,
+	fmParams *fmParams,
 	adsrParams *adsrParams,
 	noteFilterParams *noteFilterParams,
 	filterParams *filterParams,
 	formantParams *formantParams,
 	lfoParams []*lfoParams,
 	envelopeParams []*envelopeParams,
+	expressionParams *expressionParams,
 	velSense float64,
-	echo *echo,
-	out []float64,
+	velocityParams *velocityParams,
+	tuning *tuning,
+	glideParams *glideParams,
+	unisonParams *unisonParams,
+	bpm float64,
+	echoes []*echo,
+	outL []float64,
+	outR []float64,
 ) {
 	for _, o := range p.active {
-		o.applyParams(oscParams, adsrParams, noteFilterParams, filterParams, formantParams, lfoParams, envelopeParams)
+		o.applyParams(oscParams, fmParams, adsrParams, noteFilterParams, filterParams, formantParams, lfoParams, envelopeParams, expressionParams, tuning, bpm)
+		o.detuneRatio, o.pan = unisonParams.voice(o.unison, o.voices)
 	}
-	for i := int64(0); i < int64(len(out)); i++ {
+	for i := int64(0); i < int64(len(outL)); i++ {
 		events := events[i]
 		for j := 0; j < len(events); j++ {
+			channel := events[j].channel
 			switch data := events[j].event.(type) {
 			case *noteOn:
-				lenPooled := len(p.pooled)
-				if lenPooled > 0 {
+				if !tuning.mapped(data.note) {
+					break
+				}
+				retriggered := p.pedal.noteOn(data.note)
+				for _, o := range p.active {
+					if o.note == data.note && o.channel == channel {
+						if retriggered {
+							// the old voice is only held by the pedal
+							o.event = enumNoteOff
+							o.releaseRatio = 1
+						} else {
+							o.event = enumNoteOn
+						}
+					}
+				}
+				from := p.glideSource(data.note, glideParams)
+				p.lastNote = data.note
+				voices := unisonParams.voices
+				if voices > len(p.pooled) {
+					log.Println("maxPoly exceeded")
+					voices = len(p.pooled)
+				}
+				for u := 0; u < voices; u++ {
+					lenPooled := len(p.pooled)
 					o := p.pooled[lenPooled-1]
 					p.pooled = p.pooled[:lenPooled-1]
 					p.active = append(p.active, o)
 					o.note = data.note
+					o.channel = channel
 					o.velocity = data.velocity
-					o.initWithNote(oscParams, data.note)
-					o.applyParams(oscParams, adsrParams, noteFilterParams, filterParams, formantParams, lfoParams, envelopeParams)
-				} else {
-					log.Println("maxPoly exceeded")
+					o.event = enumNoteOn
+					o.releaseRatio = 1
+					o.unison = u
+					o.voices = voices
+					o.detuneRatio, o.pan = unisonParams.voice(u, voices)
+					if from >= 0 {
+						o.initWithNote(oscParams, tuning, from, data.velocity)
+						o.glide(oscParams, tuning, data.note, glideParams)
+					} else {
+						o.initWithNote(oscParams, tuning, data.note, data.velocity)
+					}
+					o.expression.init(p.channels[channel], p.masterBend)
+					o.applyParams(oscParams, fmParams, adsrParams, noteFilterParams, filterParams, formantParams, lfoParams, envelopeParams, expressionParams, tuning, bpm)
 				}
-			}
-		}
-		out[i] = 0.0
-		for _, o := range p.active {
-			event := enumNoEvent
-			for _, e := range events {
-				switch data := e.event.(type) {
-				case *noteOff:
-					if data.note == o.note {
-						event = enumNoteOff
+			case *noteOff:
+				if !p.pedal.noteOff(data.note) {
+					p.noteOff(data.note, channel, velocityParams.releaseRatio(data.velocity))
+				}
+			case *controlChange:
+				switch data.number {
+				case ccAllNotesOff:
+					p.pedal.reset()
+					for _, o := range p.active {
+						o.event = enumNoteOff
+						o.releaseRatio = 1
+					}
+				case ccAllSoundOff:
+					p.pedal.reset()
+					for _, o := range p.active {
+						o.adsr.reset()
+						o.event = enumNoEvent
+					}
+					for _, echo := range echoes {
+						echo.clear()
+					}
+				case ccTimbre:
+					timbre := float64(data.value) / 127
+					p.channels[channel].timbre = timbre
+					for _, o := range p.active {
+						if o.channel == channel {
+							o.expression.setTimbre(timbre)
+						}
 					}
-				case *noteOn:
-					if data.note == o.note {
-						event = enumNoteOn
+				}
+				for _, note := range p.pedal.controlChange(data.number, data.value) {
+					p.noteOff(note, channelOmni, 1)
+				}
+			case *pitchBend:
+				if data.master {
+					p.masterBend = data.semitones
+					for _, o := range p.active {
+						o.expression.setMasterBend(data.semitones)
+					}
+					break
+				}
+				p.channels[channel].bend = data.semitones
+				for _, o := range p.active {
+					if o.channel == channel {
+						o.expression.setBend(data.semitones)
+					}
+				}
+			case *channelPressure:
+				p.channels[channel].pressure = data.value
+				for _, o := range p.active {
+					if o.channel == channel {
+						o.expression.setPressure(data.value)
+					}
+				}
+			case *polyPressure:
+				for _, o := range p.active {
+					if o.channel == channel && o.note == data.note {
+						o.expression.setPressure(data.value)
 					}
 				}
 			}
-			gain := velocityToGain(o.velocity, velSense)
-			out[i] += o.step(event) * gain
+		}
+		left := 0.0
+		right := 0.0
+		for _, o := range p.active {
+			gain := velocityToGain(o.velocity, velSense, velocityParams) * unisonGain(o.voices)
+			value := o.step(o.event) * gain
+			gainL, gainR := panGains(o.pan)
+			left += value * gainL
+			right += value * gainR
+			o.event = enumNoEvent
 		}
 		for j := len(p.active) - 1; j >= 0; j-- {
 			o := p.active[j]
@@ -87,6 +237,7 @@ func (p *polyOsc) calc(
 				p.pooled = append(p.pooled, o)
 			}
 		}
-		out[i] = echo.step(out[i])
+		outL[i] = echoes[0].step(left)
+		outR[i] = echoes[1].step(right)
 	}
 }
@@ -0,0 +1,46 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestPolyGlide(t *testing.T) {
+	p := newParams()
+	o := newPolyOsc()
+	events := make([][]*midiEvent, samplesPerCycle*2)
+	out := make([]float64, samplesPerCycle)
+	tuning := newTuning()
+	calc := func() {
+		o.calc(events, p.oscParams, p.fmParams, p.adsrParams, p.noteFilterParams, p.filterParams, p.formantParams, p.lfoParams, p.envelopeParams, p.expressionParams, p.velSense, p.velocityParams, tuning, p.glideParams, p.unisonParams, defaultBpm, []*echo{{delay: &delay{}}, {delay: &delay{}}}, out, out)
+		for i := range events {
+			events[i] = nil
+		}
+	}
+	expectEqual(t, o.glideSource(60, p.glideParams), -1)
+	p.glideParams.poly = polyGlideLast
+	expectEqual(t, o.glideSource(60, p.glideParams), -1)
+
+	events[0] = []*midiEvent{{event: &noteOn{note: 60, velocity: 100}}, {event: &noteOn{note: 72, velocity: 100}}}
+	calc()
+	expectEqual(t, o.glideSource(62, p.glideParams), 72)
+	p.glideParams.poly = polyGlideNearest
+	expectEqual(t, o.glideSource(62, p.glideParams), 60)
+
+	// the new voice starts from the pitch of the nearest voice
+	events[0] = []*midiEvent{{event: &noteOn{note: 62, velocity: 100}}}
+	events[1] = []*midiEvent{{event: &noteOff{note: 60, velocity: 64}}, {event: &noteOff{note: 72, velocity: 64}}}
+	calc()
+	v := o.active[2]
+	expectEqual(t, v.note, 62)
+	expectNearlyEqual(t, v.oscs[0].freq.initialValue, tuning.freq(60))
+	expectNearlyEqual(t, v.oscs[0].freq.targetValue, tuning.freq(62))
+
+	// only while other notes are held
+	expectEqual(t, o.glideSource(64, p.glideParams), 62)
+	p.glideParams.poly = polyGlideLast
+	events[0] = []*midiEvent{{event: &noteOff{note: 62, velocity: 64}}}
+	calc()
+	expectEqual(t, o.glideSource(64, p.glideParams), -1)
+	p.glideParams.legatoOnly = false
+	expectEqual(t, o.glideSource(64, p.glideParams), 62)
+}
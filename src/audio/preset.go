@@ -6,6 +6,9 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 )
 
 type presetMetaJSON struct {
@@ -20,10 +23,25 @@ type presetMeta struct {
 type presetData struct {
 	list []*presetMeta
 }
+type programMapItemJSON struct {
+	Bank    int    `json:"bank"`
+	Program int    `json:"program"`
+	Name    string `json:"name"`
+}
+type programMapJSON struct {
+	Items []programMapItemJSON `json:"items"`
+}
+type programKey struct {
+	bank    int
+	program int
+}
+
+// locked by itself as used by the MIDI goroutine, the command goroutine and the main loop
 type presetManager struct {
-	selected string
-	dir      string
-	data     *presetData
+	sync.Mutex
+	dir        string
+	data       *presetData
+	programMap map[programKey]string
 }
 
 func newPresetManager(dir string) *presetManager {
@@ -38,18 +56,29 @@ func (pm *presetManager) _nameToJSONPath(name string) string {
 // ----- Params ----- //
 
 func (pm *presetManager) applyToParams(name string, target *params) error {
-	path := pm._nameToJSONPath(name)
-	bytes, err := ioutil.ReadFile(path)
+	bytes, err := pm.readParams(name)
 	if err != nil {
 		return err
 	}
 	target.applyJSON(bytes)
-	pm.selected = name
 	return nil
 }
+func (pm *presetManager) readParams(name string) (json.RawMessage, error) {
+	path := pm._nameToJSONPath(name)
+	return ioutil.ReadFile(path)
+}
 func (pm *presetManager) restoreLastParams(p *params) (bool, error) {
 	return pm._loadParams("_tmp", p)
 }
+func (pm *presetManager) restoreLastSession(s *state) (bool, error) {
+	path := pm._nameToJSONPath("_session")
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, nil
+	}
+	s.applyJSON(bytes)
+	return true, nil
+}
 func (pm *presetManager) _loadParams(name string, p *params) (bool, error) {
 	path := pm._nameToJSONPath(name)
 	bytes, err := ioutil.ReadFile(path)
@@ -59,13 +88,18 @@ func (pm *presetManager) _loadParams(name string, p *params) (bool, error) {
 	p.applyJSON(bytes)
 	return true, nil
 }
-func (pm *presetManager) saveTemporaryParams(p *params) error {
-	return pm._saveParams("_tmp", p)
+func (pm *presetManager) saveTemporarySession(s *state) error {
+	os.MkdirAll(pm.dir, os.ModePerm)
+	path := pm._nameToJSONPath("_session")
+	j := s.toJSON()
+	return ioutil.WriteFile(path, j, 0666)
 }
-func (pm *presetManager) overrideParams(p *params) (bool, error) {
-	return pm.saveParams(pm.selected, p)
+func (pm *presetManager) overrideParams(name string, p *params) (bool, error) {
+	return pm.saveParams(name, p)
 }
 func (pm *presetManager) saveParams(name string, p *params) (bool, error) {
+	pm.Lock()
+	defer pm.Unlock()
 	if name == "" {
 		return false, fmt.Errorf("empty name cannot be accepted")
 	}
@@ -85,6 +119,8 @@ func (pm *presetManager) _saveParams(name string, p *params) error {
 	return ioutil.WriteFile(path, j, 0666)
 }
 func (pm *presetManager) remove(name string) (bool, error) {
+	pm.Lock()
+	defer pm.Unlock()
 	if name == "" {
 		return false, fmt.Errorf("empty name cannot be accepted")
 	}
@@ -106,6 +142,8 @@ func (pm *presetManager) _removeParams(name string) error {
 // ----- List ----- //
 
 func (pm *presetManager) existsInList(name string) (bool, error) {
+	pm.Lock()
+	defer pm.Unlock()
 	if err := pm._ensureList(); err != nil {
 		return false, err
 	}
@@ -117,10 +155,12 @@ func (pm *presetManager) existsInList(name string) (bool, error) {
 	return false, nil
 }
 func (pm *presetManager) getList() ([]*presetMeta, error) {
+	pm.Lock()
+	defer pm.Unlock()
 	if err := pm._ensureList(); err != nil {
 		return nil, err
 	}
-	return pm.data.list, nil
+	return append([]*presetMeta{}, pm.data.list...), nil
 }
 func (pm *presetManager) _upsertList(name string) (bool, error) {
 	for _, meta := range pm.data.list {
@@ -161,6 +201,8 @@ func (pm *presetManager) _saveInitialList() error {
 	return ioutil.WriteFile(path, []byte(`{"items":[]}`), 0666)
 }
 func (pm *presetManager) listToJSON() (json.RawMessage, error) {
+	pm.Lock()
+	defer pm.Unlock()
 	if err := pm._ensureList(); err != nil {
 		return nil, err
 	}
@@ -209,3 +251,117 @@ func (pm *presetManager) _loadList() error {
 	}
 	return nil
 }
+
+// ----- Program Map ----- //
+
+func parseBankAndProgram(bankString string, programString string) (int, int, error) {
+	bank, err := strconv.ParseInt(bankString, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if bank < 0 || bank >= 128*128 {
+		return 0, 0, fmt.Errorf("invalid bank %v", bankString)
+	}
+	program, err := strconv.ParseInt(programString, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if program < 0 || program >= 128 {
+		return 0, 0, fmt.Errorf("invalid program %v", programString)
+	}
+	return int(bank), int(program), nil
+}
+
+// falls back to the list order when the map has no entry
+func (pm *presetManager) resolveProgram(bank int, program int) (string, error) {
+	pm.Lock()
+	defer pm.Unlock()
+	if err := pm._ensureProgramMap(); err != nil {
+		return "", err
+	}
+	if name, ok := pm.programMap[programKey{bank: bank, program: program}]; ok {
+		return name, nil
+	}
+	if err := pm._ensureList(); err != nil {
+		return "", err
+	}
+	index := bank*128 + program
+	if index >= len(pm.data.list) {
+		return "", nil
+	}
+	return pm.data.list[index].name, nil
+}
+func (pm *presetManager) setProgram(bank int, program int, name string) error {
+	pm.Lock()
+	defer pm.Unlock()
+	if err := pm._ensureProgramMap(); err != nil {
+		return err
+	}
+	pm.programMap[programKey{bank: bank, program: program}] = name
+	return pm._saveProgramMap()
+}
+func (pm *presetManager) removeProgram(bank int, program int) error {
+	pm.Lock()
+	defer pm.Unlock()
+	if err := pm._ensureProgramMap(); err != nil {
+		return err
+	}
+	delete(pm.programMap, programKey{bank: bank, program: program})
+	return pm._saveProgramMap()
+}
+func (pm *presetManager) programMapToJSON() (json.RawMessage, error) {
+	pm.Lock()
+	defer pm.Unlock()
+	if err := pm._ensureProgramMap(); err != nil {
+		return nil, err
+	}
+	return pm._programMapToJSON(), nil
+}
+func (pm *presetManager) _programMapToJSON() json.RawMessage {
+	items := make([]programMapItemJSON, 0, len(pm.programMap))
+	for key, name := range pm.programMap {
+		items = append(items, programMapItemJSON{
+			Bank:    key.bank,
+			Program: key.program,
+			Name:    name,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Bank != items[j].Bank {
+			return items[i].Bank < items[j].Bank
+		}
+		return items[i].Program < items[j].Program
+	})
+	return toRawMessage(&programMapJSON{Items: items})
+}
+func (pm *presetManager) _saveProgramMap() error {
+	os.MkdirAll(pm.dir, os.ModePerm)
+	path := pm._nameToJSONPath("_program_map")
+	return ioutil.WriteFile(path, pm._programMapToJSON(), 0666)
+}
+func (pm *presetManager) _ensureProgramMap() error {
+	if pm.programMap == nil {
+		return pm._loadProgramMap()
+	}
+	return nil
+}
+func (pm *presetManager) _loadProgramMap() error {
+	pm.programMap = make(map[programKey]string)
+	path := pm._nameToJSONPath("_program_map")
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	j := &programMapJSON{}
+	err = json.Unmarshal(bytes, j)
+	if err != nil {
+		return err
+	}
+	for _, item := range j.Items {
+		pm.programMap[programKey{bank: item.Bank, program: item.Program}] = item.Name
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package audio
+
+import "math"
+
+// ----- Sample Player ----- //
+
+// samples are assumed to be recorded in 12-TET with A4 = 440Hz (regardless of the tuning)
+const sampleReferenceFreq = 440.0
+
+type samplePlayer struct {
+	instrument *sampleInstrument
+	region     *sampleRegion // nil if no regions match
+	velocity   int
+	position   float64 // index of the sample
+	released   bool
+}
+
+func newSamplePlayer() *samplePlayer {
+	return &samplePlayer{}
+}
+func (s *samplePlayer) init(instrument *sampleInstrument, note int, velocity int) {
+	s.instrument = instrument
+	s.velocity = velocity
+	s.selectRegion(note)
+	s.reset()
+}
+
+// keeps the position when gliding to another note
+func (s *samplePlayer) selectRegion(note int) {
+	s.region = nil
+	if s.instrument != nil {
+		s.region = s.instrument.region(note, s.velocity)
+	}
+}
+func (s *samplePlayer) reset() {
+	s.position = 0
+	s.released = false
+}
+func (s *samplePlayer) valueAt(interpolation int) float64 {
+	r := s.region
+	if r == nil {
+		return 0
+	}
+	values := r.sample.values
+	i := int(s.position)
+	if i >= len(values) {
+		return 0
+	}
+	if interpolation == interpolationNone {
+		return values[i] * r.gain
+	}
+	t := s.position - float64(i)
+	y1 := values[i]
+	y2 := 0.0
+	if s.looping() && i == r.loopEnd {
+		y2 = values[r.loopStart]
+	} else if i+1 < len(values) {
+		y2 = values[i+1]
+	}
+	return (y1 + (y2-y1)*t) * r.gain
+}
+func (s *samplePlayer) looping() bool {
+	if s.region == nil {
+		return false
+	}
+	switch s.region.loopMode {
+	case loopContinuous:
+		return true
+	case loopSustain:
+		return !s.released
+	}
+	return false
+}
+
+// freq: the frequency of the oscillator
+func (s *samplePlayer) advance(freq float64) {
+	r := s.region
+	if r == nil {
+		return
+	}
+	base := sampleReferenceFreq * math.Pow(2, (float64(r.keycenter-69-r.transpose)*100-float64(r.tune))/1200)
+	s.position += math.Abs(freq) / base * float64(r.sample.sampleRate) / float64(sampleRate)
+	if s.looping() && s.position >= float64(r.loopEnd+1) {
+		length := float64(r.loopEnd + 1 - r.loopStart)
+		s.position = float64(r.loopStart) + math.Mod(s.position-float64(r.loopStart), length)
+	}
+}
@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"testing"
+)
+
+func newTestInstrument(loopMode int) *sampleInstrument {
+	s := &sample{values: []float64{0, 1, 2, 3, 4, 5}, sampleRate: sampleRate}
+	return &sampleInstrument{regions: []*sampleRegion{{
+		sample:    s,
+		lokey:     0,
+		hikey:     127,
+		lovel:     1,
+		hivel:     127,
+		keycenter: 69,
+		gain:      1,
+		loopMode:  loopMode,
+		loopStart: 2,
+		loopEnd:   4,
+	}}}
+}
+
+func TestSamplePlayer(t *testing.T) {
+	s := newSamplePlayer()
+	s.init(newTestInstrument(loopNone), 69, 100)
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 0)
+	// an octave higher
+	s.advance(sampleReferenceFreq * 2)
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 2)
+	// a fifth lower
+	s.advance(sampleReferenceFreq / 2)
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 2.5)
+	expectNearlyEqual(t, s.valueAt(interpolationNone), 2)
+	for i := 0; i < 10; i++ {
+		s.advance(sampleReferenceFreq)
+	}
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 0)
+
+	s.init(newTestInstrument(loopContinuous), 69, 100)
+	for i := 0; i < 5; i++ {
+		s.advance(sampleReferenceFreq)
+	}
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 2)
+	s.advance(sampleReferenceFreq / 2)
+	s.advance(sampleReferenceFreq * 2)
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 3) // between 4 and the loop start
+	s.advance(sampleReferenceFreq)
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 2.5)
+
+	s.init(newTestInstrument(loopSustain), 69, 100)
+	for i := 0; i < 5; i++ {
+		s.advance(sampleReferenceFreq)
+	}
+	expectNearlyEqual(t, s.valueAt(interpolationNone), 2)
+	s.released = true
+	s.advance(sampleReferenceFreq)
+	s.advance(sampleReferenceFreq)
+	expectNearlyEqual(t, s.valueAt(interpolationNone), 4)
+
+	s.init(nil, 69, 100)
+	s.advance(sampleReferenceFreq)
+	expectNearlyEqual(t, s.valueAt(interpolationLinear), 0)
+}
+
+func TestSampleOsc(t *testing.T) {
+	p := newOscParams()
+	p.enabled = true
+	p.kind = waveSample
+	p.instrument = newTestInstrument(loopNone)
+	o := newOsc(true)
+	tuning := newTuning()
+	expectNoError(t, tuning.setReferenceFreq(440))
+	o.initWithNote(p, tuning, 69, 100)
+	expectNearlyEqual(t, o.step(1, 0), 0)
+	expectNearlyEqual(t, o.step(1, 0), 1)
+	expectNearlyEqual(t, o.step(2, 0), 2)
+	expectNearlyEqual(t, o.step(1, 0), 4)
+
+	// follows the tuning like the other waves
+	o.initWithNote(p, newTuning(), 69, 100)
+	o.step(1, 0)
+	expectNearlyEqual(t, o.step(1, 0), baseFreq/sampleReferenceFreq)
+}
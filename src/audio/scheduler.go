@@ -0,0 +1,44 @@
+package audio
+
+// ----- Scheduler ----- //
+
+// MIDI messages waiting to be played in later cycles
+type scheduledMidi struct {
+	index int // samples from the start of the next cycle
+	data  []byte
+}
+
+type scheduler struct {
+	items []*scheduledMidi
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		items: make([]*scheduledMidi, 0),
+	}
+}
+
+func (s *scheduler) add(index int, data []byte) {
+	s.items = append(s.items, &scheduledMidi{index: index, data: data})
+}
+func (s *scheduler) clear() {
+	s.items = s.items[:0]
+}
+
+// sends messages scheduled in the next `length` samples
+func (s *scheduler) process(length int, send func(index int, data []byte)) {
+	left := 0
+	for _, item := range s.items {
+		if item.index < length {
+			send(item.index, item.data)
+		} else {
+			item.index -= length
+			s.items[left] = item
+			left++
+		}
+	}
+	for i := left; i < len(s.items); i++ {
+		s.items[i] = nil
+	}
+	s.items = s.items[:left]
+}
@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler()
+	s.add(10, []byte{0x80, 60, 64})
+	s.add(samplesPerCycle+5, []byte{0x80, 62, 64})
+	indices := make([]int, 0)
+	send := func(index int, data []byte) {
+		indices = append(indices, index)
+	}
+	s.process(samplesPerCycle, send)
+	expectEqual(t, len(indices), 1)
+	expectEqual(t, indices[0], 10)
+	s.process(samplesPerCycle, send)
+	expectEqual(t, len(indices), 2)
+	expectEqual(t, indices[1], 5)
+	expectEqual(t, len(s.items), 0)
+}
+
+func TestAllSoundOff(t *testing.T) {
+	p := newParams()
+	o := newPolyOsc()
+	events := make([][]*midiEvent, samplesPerCycle*2)
+	out := make([]float64, samplesPerCycle)
+	calc := func() {
+		o.calc(events, p.oscParams, p.fmParams, p.adsrParams, p.noteFilterParams, p.filterParams, p.formantParams, p.lfoParams, p.envelopeParams, p.expressionParams, p.velSense, p.velocityParams, newTuning(), p.glideParams, p.unisonParams, defaultBpm, []*echo{{delay: &delay{}}, {delay: &delay{}}}, out, out)
+		for i := range events {
+			events[i] = nil
+		}
+	}
+	events[0] = []*midiEvent{{event: &noteOn{note: 60, velocity: 100}}, {event: &controlChange{number: ccSustain, value: 127}}}
+	events[1] = []*midiEvent{{event: &noteOff{note: 60, velocity: 64}}}
+	calc()
+	expectEqual(t, len(o.active), 1)
+	events[0] = []*midiEvent{{channel: channelOmni, event: &controlChange{number: ccAllSoundOff}}}
+	calc()
+	expectEqual(t, len(o.active), 0)
+	expectEqual(t, o.pedal.sustain, false)
+}
@@ -0,0 +1,447 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	minSteps    = 16
+	maxSteps    = 64
+	maxPatterns = 16
+)
+
+// ----- Sequencer Step ----- //
+
+// a parameter overridden while the step is current
+type paramLock struct {
+	path  []string // same as "set" commands
+	value float64
+}
+
+type seqStep struct {
+	active   bool
+	note     int
+	velocity int
+	gate     float64 // 0 ~ 1, ratio of a step
+	tie      bool    // holds the previous note without retriggering
+	locks    []*paramLock
+}
+
+type seqStepJSON struct {
+	Active   bool               `json:"active"`
+	Note     int                `json:"note"`
+	Velocity int                `json:"velocity"`
+	Gate     float64            `json:"gate"`
+	Tie      bool               `json:"tie"`
+	Locks    map[string]float64 `json:"locks"`
+}
+
+func newSeqStep() *seqStep {
+	return &seqStep{
+		active:   false,
+		note:     60,
+		velocity: 100,
+		gate:     0.5,
+		tie:      false,
+		locks:    make([]*paramLock, 0),
+	}
+}
+func (s *seqStep) applyJSON(j *seqStepJSON) {
+	s.active = j.Active
+	s.note = j.Note
+	s.velocity = j.Velocity
+	s.gate = j.Gate
+	s.tie = j.Tie
+	s.locks = s.locks[:0]
+	for key, value := range j.Locks {
+		s.lock(strings.Split(key, " "), value)
+	}
+}
+func (s *seqStep) toJSON() *seqStepJSON {
+	locks := make(map[string]float64)
+	for _, l := range s.locks {
+		locks[strings.Join(l.path, " ")] = l.value
+	}
+	return &seqStepJSON{
+		Active:   s.active,
+		Note:     s.note,
+		Velocity: s.velocity,
+		Gate:     s.gate,
+		Tie:      s.tie,
+		Locks:    locks,
+	}
+}
+func (s *seqStep) set(key string, value string) error {
+	switch key {
+	case "active":
+		s.active = value == "true"
+	case "note":
+		value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if value < 0 || value > 127 {
+			return fmt.Errorf("invalid note %v", value)
+		}
+		s.note = int(value)
+	case "velocity":
+		value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if value < 1 || value > 127 {
+			return fmt.Errorf("invalid velocity %v", value)
+		}
+		s.velocity = int(value)
+	case "gate":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		s.gate = value
+	case "tie":
+		s.tie = value == "true"
+	}
+	return nil
+}
+func (s *seqStep) lock(path []string, value float64) {
+	s.unlock(path)
+	s.locks = append(s.locks, &paramLock{path: path, value: value})
+}
+func (s *seqStep) unlock(path []string) {
+	key := strings.Join(path, " ")
+	for i := len(s.locks) - 1; i >= 0; i-- {
+		if strings.Join(s.locks[i].path, " ") == key {
+			s.locks = append(s.locks[:i], s.locks[i+1:]...)
+		}
+	}
+}
+
+// ----- Sequencer Pattern ----- //
+
+type seqPattern struct {
+	length int        // minSteps ~ maxSteps
+	steps  []*seqStep // length: maxSteps
+}
+
+type seqPatternJSON struct {
+	Length int            `json:"length"`
+	Steps  []*seqStepJSON `json:"steps"`
+}
+
+func newSeqPattern() *seqPattern {
+	steps := make([]*seqStep, maxSteps)
+	for i := range steps {
+		steps[i] = newSeqStep()
+	}
+	return &seqPattern{
+		length: minSteps,
+		steps:  steps,
+	}
+}
+func (p *seqPattern) applyJSON(j *seqPatternJSON) {
+	if j.Length < minSteps || j.Length > maxSteps || len(j.Steps) > maxSteps {
+		log.Println("failed to apply JSON to seqPattern")
+		return
+	}
+	p.length = j.Length
+	for i, step := range p.steps {
+		if i < len(j.Steps) {
+			step.applyJSON(j.Steps[i])
+		} else {
+			*step = *newSeqStep()
+		}
+	}
+}
+
+// only steps within the length are saved
+func (p *seqPattern) toJSON() *seqPatternJSON {
+	steps := make([]*seqStepJSON, p.length)
+	for i := range steps {
+		steps[i] = p.steps[i].toJSON()
+	}
+	return &seqPatternJSON{
+		Length: p.length,
+		Steps:  steps,
+	}
+}
+func (p *seqPattern) setLength(value string) error {
+	length, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	if length < minSteps || length > maxSteps {
+		return fmt.Errorf("invalid pattern length %v", value)
+	}
+	p.length = int(length)
+	return nil
+}
+
+// ----- Sequencer Params ----- //
+
+type seqParams struct {
+	enabled  bool
+	division string // length of a step
+	pattern  int    // index of the pattern to play
+	patterns []*seqPattern
+}
+
+type seqJSON struct {
+	Enabled  bool              `json:"enabled"`
+	Division string            `json:"division"`
+	Pattern  int               `json:"pattern"`
+	Patterns []*seqPatternJSON `json:"patterns"`
+}
+
+func newSeqParams() *seqParams {
+	return &seqParams{
+		enabled:  false,
+		division: "1/16",
+		pattern:  0,
+		patterns: []*seqPattern{newSeqPattern()},
+	}
+}
+func (s *seqParams) applyJSON(data json.RawMessage) {
+	var j seqJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil || len(j.Patterns) == 0 || len(j.Patterns) > maxPatterns {
+		log.Println("failed to apply JSON to seqParams")
+		return
+	}
+	s.enabled = j.Enabled
+	s.division = j.Division
+	s.patterns = make([]*seqPattern, len(j.Patterns))
+	for i, pattern := range j.Patterns {
+		s.patterns[i] = newSeqPattern()
+		s.patterns[i].applyJSON(pattern)
+	}
+	s.pattern = 0
+	if j.Pattern >= 0 && j.Pattern < len(s.patterns) {
+		s.pattern = j.Pattern
+	}
+}
+func (s *seqParams) toJSON() json.RawMessage {
+	patterns := make([]*seqPatternJSON, len(s.patterns))
+	for i, pattern := range s.patterns {
+		patterns[i] = pattern.toJSON()
+	}
+	return toRawMessage(&seqJSON{
+		Enabled:  s.enabled,
+		Division: s.division,
+		Pattern:  s.pattern,
+		Patterns: patterns,
+	})
+}
+func (s *seqParams) set(key string, value string) error {
+	switch key {
+	case "enabled":
+		s.enabled = value == "true"
+	case "division":
+		_, err := divisionToBeats(value)
+		if err != nil {
+			return err
+		}
+		s.division = value
+	case "pattern":
+		index, err := parseIndex(value, len(s.patterns))
+		if err != nil {
+			return err
+		}
+		s.pattern = index
+	}
+	return nil
+}
+func (s *seqParams) currentPattern() *seqPattern {
+	return s.patterns[s.pattern]
+}
+func (s *seqParams) addPattern() error {
+	if len(s.patterns) >= maxPatterns {
+		return fmt.Errorf("too many patterns")
+	}
+	s.patterns = append(s.patterns, newSeqPattern())
+	return nil
+}
+func (s *seqParams) removePattern(index int) error {
+	if len(s.patterns) <= 1 {
+		return fmt.Errorf("at least one pattern is required")
+	}
+	s.patterns = append(s.patterns[:index], s.patterns[index+1:]...)
+	if s.pattern >= len(s.patterns) {
+		s.pattern = len(s.patterns) - 1
+	}
+	return nil
+}
+
+// ----- Sequencer ----- //
+
+type lockedValue struct {
+	target   *float64
+	original float64
+}
+
+// an active step triggered at the index of the block
+type seqTrigger struct {
+	index int
+	step  *seqStep
+}
+
+type sequencer struct {
+	playing   bool
+	step      int      // index of the next step
+	countdown float64  // samples until the next step
+	sounding  int      // -1 if none
+	gateLeft  float64  // samples until the sounding note is released
+	current   *seqStep // the latest active step, whose locks are applied until the next one
+	initial   *seqStep // current at the start of the block
+	triggers  []seqTrigger
+	locked    []lockedValue
+}
+
+func newSequencer() *sequencer {
+	return &sequencer{
+		sounding: -1,
+		triggers: make([]seqTrigger, 0),
+		locked:   make([]lockedValue, 0),
+	}
+}
+func (s *sequencer) start() {
+	s.playing = true
+	s.step = 0
+	s.countdown = 0
+}
+
+// the sounding note is released in the next process()
+func (s *sequencer) stop() {
+	s.playing = false
+}
+
+// adds note events of the steps in the first `length` slots
+// channel: the channel of the part (channelOmni for channel 1)
+func (s *sequencer) process(events [][]*midiEvent, length int, p *seqParams, bpm float64, channel int, send func(data []byte)) {
+	if channel == channelOmni {
+		channel = 0
+	}
+	s.triggers = s.triggers[:0]
+	if !p.enabled || !s.playing {
+		if s.sounding >= 0 || s.current != nil {
+			s.release(events, 0, channel, send)
+			s.current = nil
+		}
+		s.initial = nil
+		return
+	}
+	s.initial = s.current
+	stepLength := divisionToMillis(p.division, bpm) / 1000 * sampleRate
+	pattern := p.currentPattern()
+	for i := 0; i < length; i++ {
+		if s.sounding >= 0 {
+			s.gateLeft--
+		}
+		if s.countdown <= 0 {
+			if s.step >= pattern.length {
+				s.step = 0
+			}
+			step := pattern.steps[s.step]
+			next := pattern.steps[(s.step+1)%pattern.length]
+			s.trigger(events, i, step, next, stepLength, channel, send)
+			s.step++
+			s.countdown += stepLength
+		}
+		if s.sounding >= 0 && s.gateLeft <= 0 {
+			s.release(events, i, channel, send)
+		}
+		s.countdown--
+	}
+}
+func (s *sequencer) trigger(events [][]*midiEvent, i int, step *seqStep, next *seqStep, stepLength float64, channel int, send func(data []byte)) {
+	if !step.active {
+		return // rests keep the locks of the previous step
+	}
+	s.current = step
+	s.triggers = append(s.triggers, seqTrigger{index: i, step: step})
+	if step.tie && s.sounding >= 0 {
+		if step.note != s.sounding {
+			// legato: the new note starts before the old one ends
+			addGeneratedNote(events, i, channel, &noteOn{note: step.note, velocity: step.velocity}, send)
+			addGeneratedNote(events, i, channel, &noteOff{note: s.sounding, velocity: defaultReleaseVelocity}, send)
+			s.sounding = step.note
+		}
+	} else {
+		s.release(events, i, channel, send)
+		addGeneratedNote(events, i, channel, &noteOn{note: step.note, velocity: step.velocity}, send)
+		s.sounding = step.note
+	}
+	s.gateLeft = stepLength * step.gate
+	if next.active && next.tie {
+		s.gateLeft = stepLength + 1 // held until the next step
+	}
+}
+func (s *sequencer) release(events [][]*midiEvent, i int, channel int, send func(data []byte)) {
+	if s.sounding < 0 {
+		return
+	}
+	addGeneratedNote(events, i, channel, &noteOff{note: s.sounding, velocity: defaultReleaseVelocity}, send)
+	s.sounding = -1
+}
+
+// calls calc for each range of the block processed by process(),
+// with the locks of the step that is current in the range
+func (s *sequencer) calcWithLocks(p *params, length int, calc func(start int, end int)) {
+	start := 0
+	step := s.initial
+	for _, t := range s.triggers {
+		if t.index > start {
+			s.applyLocks(p, step)
+			calc(start, t.index)
+			s.restoreLocks()
+		}
+		start = t.index
+		step = t.step
+	}
+	if start < length {
+		s.applyLocks(p, step)
+		calc(start, length)
+		s.restoreLocks()
+	}
+}
+
+// overrides params by the locks of the step until restoreLocks() is called
+func (s *sequencer) applyLocks(p *params, step *seqStep) {
+	if step == nil {
+		return
+	}
+	for _, l := range step.locks {
+		target, err := p.continuousParam(l.path)
+		if err != nil {
+			continue
+		}
+		s.locked = append(s.locked, lockedValue{target: target, original: *target})
+		*target = l.value
+	}
+}
+func (s *sequencer) restoreLocks() {
+	for i := len(s.locked) - 1; i >= 0; i-- {
+		*s.locked[i].target = s.locked[i].original
+	}
+	s.locked = s.locked[:0]
+}
+
+type sequencerJSON struct {
+	Playing bool `json:"playing"`
+	Step    int  `json:"step"` // index of the current step, -1 if stopped
+}
+
+func (s *sequencer) toJSON() *sequencerJSON {
+	step := -1
+	if s.playing {
+		step = s.step - 1
+	}
+	return &sequencerJSON{
+		Playing: s.playing,
+		Step:    step,
+	}
+}
@@ -0,0 +1,67 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestSequencer(t *testing.T) {
+	p := newParams()
+	p.seqParams.enabled = true
+	pattern := p.seqParams.currentPattern()
+	expectNoError(t, pattern.steps[0].set("active", "true"))
+	expectNoError(t, pattern.steps[0].set("note", "48"))
+	expectNoError(t, pattern.steps[1].set("active", "true"))
+	expectNoError(t, pattern.steps[1].set("note", "50"))
+	expectNoError(t, pattern.steps[1].set("tie", "true"))
+	pattern.steps[1].lock([]string{"filter", "freq"}, 3000)
+
+	s := newSequencer()
+	s.start()
+	stepLength := int(divisionToMillis("1/16", defaultBpm) / 1000 * sampleRate) // 6000 samples
+	events := make([][]*midiEvent, stepLength*3)
+	var sent [][]byte
+	s.process(events, stepLength*3, p.seqParams, defaultBpm, 2, func(data []byte) {
+		sent = append(sent, data)
+	})
+	// also sent as MIDI data on the part's channel
+	expectEqual(t, len(sent), 4)
+	expectEqual(t, sent[0][0], byte(0x92))
+	expectEqual(t, sent[0][1], byte(48))
+	expectEqual(t, sent[2][0], byte(0x82))
+	expectEqual(t, sent[2][1], byte(48))
+	expectEqual(t, sent[3][0], byte(0x82))
+	expectEqual(t, sent[3][1], byte(50))
+	_, ok := events[0][0].event.(*noteOn)
+	expectEqual(t, ok, true)
+	// the tied step starts before the previous note ends
+	expectEqual(t, len(events[stepLength]), 2)
+	on, ok := events[stepLength][0].event.(*noteOn)
+	expectEqual(t, ok, true)
+	expectEqual(t, on.note, 50)
+	off, ok := events[stepLength][1].event.(*noteOff)
+	expectEqual(t, ok, true)
+	expectEqual(t, off.note, 48)
+
+	// locks start at the step (and are kept during the rest that follows)
+	var ranges [][2]int
+	var freqs []float64
+	s.calcWithLocks(p, stepLength*3, func(start int, end int) {
+		ranges = append(ranges, [2]int{start, end})
+		freqs = append(freqs, p.filterParams.freq)
+	})
+	expectEqual(t, len(ranges), 2)
+	expectEqual(t, ranges[0], [2]int{0, stepLength})
+	expectEqual(t, ranges[1], [2]int{stepLength, stepLength * 3})
+	expectNearlyEqual(t, freqs[0], 1000)
+	expectNearlyEqual(t, freqs[1], 3000)
+	expectNearlyEqual(t, p.filterParams.freq, 1000)
+
+	// the lock continues into the next block
+	freqs = freqs[:0]
+	s.process(make([][]*midiEvent, stepLength), stepLength, p.seqParams, defaultBpm, 2, ignoreMidi)
+	s.calcWithLocks(p, stepLength, func(start int, end int) {
+		freqs = append(freqs, p.filterParams.freq)
+	})
+	expectEqual(t, len(freqs), 1)
+	expectNearlyEqual(t, freqs[0], 3000)
+}
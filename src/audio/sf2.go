@@ -0,0 +1,477 @@
+package audio
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ----- SoundFont 2 ----- //
+
+// generators
+const (
+	genStartAddrsOffset           = 0
+	genEndAddrsOffset             = 1
+	genStartloopAddrsOffset       = 2
+	genEndloopAddrsOffset         = 3
+	genStartAddrsCoarseOffset     = 4
+	genInitialFilterFc            = 8
+	genInitialFilterQ             = 9
+	genEndAddrsCoarseOffset       = 12
+	genDelayVolEnv                = 33
+	genAttackVolEnv               = 34
+	genHoldVolEnv                 = 35
+	genDecayVolEnv                = 36
+	genSustainVolEnv              = 37
+	genReleaseVolEnv              = 38
+	genInstrument                 = 41
+	genKeyRange                   = 43
+	genVelRange                   = 44
+	genStartloopAddrsCoarseOffset = 45
+	genInitialAttenuation         = 48
+	genEndloopAddrsCoarseOffset   = 50
+	genCoarseTune                 = 51
+	genFineTune                   = 52
+	genSampleID                   = 53
+	genSampleModes                = 54
+	genOverridingRootKey          = 58
+)
+
+// defaults other than 0
+var sf2DefaultGenerators = map[int]int{
+	genInitialFilterFc:   13500,
+	genDelayVolEnv:       -12000,
+	genAttackVolEnv:      -12000,
+	genHoldVolEnv:        -12000,
+	genDecayVolEnv:       -12000,
+	genReleaseVolEnv:     -12000,
+	genKeyRange:          127 << 8,
+	genVelRange:          127 << 8,
+	genOverridingRootKey: -1,
+}
+
+type sf2Zone map[int]int // generator amounts by operator
+
+func (z sf2Zone) get(oper int) int {
+	if amount, ok := z[oper]; ok {
+		return amount
+	}
+	return sf2DefaultGenerators[oper]
+}
+
+// ranges are stored as lo + hi << 8
+func (z sf2Zone) rangeOf(oper int) (int, int) {
+	r := z.get(oper)
+	return r & 0xFF, r >> 8
+}
+
+type sf2Sample struct {
+	name            string
+	start           int
+	end             int
+	startLoop       int
+	endLoop         int
+	sampleRate      int
+	originalPitch   int
+	pitchCorrection int
+}
+type sf2PresetHeader struct {
+	name    string
+	program int
+	bank    int
+	zones   []sf2Zone // the first one may be global
+}
+type sf2InstrumentHeader struct {
+	name  string
+	zones []sf2Zone
+}
+type soundFont struct {
+	data        []float64
+	presets     []*sf2PresetHeader
+	instruments []*sf2InstrumentHeader
+	samples     []*sf2Sample
+}
+
+// a preset converted to the engine
+type sf2Preset struct {
+	instrument   *sampleInstrument
+	adsrParams   *adsrParams
+	filterParams *filterParams
+}
+
+func readSoundFont(r io.Reader) (*soundFont, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, fmt.Errorf("not a SoundFont 2 file")
+	}
+	chunks := make(map[string][]byte)
+	readSF2Chunks(data[12:], chunks)
+	for _, id := range []string{"smpl", "phdr", "pbag", "pgen", "inst", "ibag", "igen", "shdr"} {
+		if _, ok := chunks[id]; !ok {
+			return nil, fmt.Errorf("%v chunk not found", id)
+		}
+	}
+	sf := &soundFont{}
+	smpl := chunks["smpl"]
+	sf.data = make([]float64, len(smpl)/2)
+	for i := range sf.data {
+		sf.data[i] = float64(int16(binary.LittleEndian.Uint16(smpl[i*2:]))) / (1 << 15)
+	}
+	shdr := chunks["shdr"]
+	for i := 0; i+46 <= len(shdr)-46; i += 46 { // the last one is a terminal
+		b := shdr[i : i+46]
+		sf.samples = append(sf.samples, &sf2Sample{
+			name:            sf2Name(b[0:20]),
+			start:           int(binary.LittleEndian.Uint32(b[20:])),
+			end:             int(binary.LittleEndian.Uint32(b[24:])),
+			startLoop:       int(binary.LittleEndian.Uint32(b[28:])),
+			endLoop:         int(binary.LittleEndian.Uint32(b[32:])),
+			sampleRate:      int(binary.LittleEndian.Uint32(b[36:])),
+			originalPitch:   int(b[40]),
+			pitchCorrection: int(int8(b[41])),
+		})
+	}
+	phdr := chunks["phdr"]
+	presetZones := readSF2Zones(chunks["pbag"], chunks["pgen"])
+	for i := 0; i+38 <= len(phdr)-38; i += 38 {
+		b := phdr[i : i+76]
+		from := int(binary.LittleEndian.Uint16(b[24:]))
+		to := int(binary.LittleEndian.Uint16(b[38+24:]))
+		if from > to || to > len(presetZones) {
+			return nil, fmt.Errorf("invalid preset zones")
+		}
+		sf.presets = append(sf.presets, &sf2PresetHeader{
+			name:    sf2Name(b[0:20]),
+			program: int(binary.LittleEndian.Uint16(b[20:])),
+			bank:    int(binary.LittleEndian.Uint16(b[22:])),
+			zones:   presetZones[from:to],
+		})
+	}
+	inst := chunks["inst"]
+	instrumentZones := readSF2Zones(chunks["ibag"], chunks["igen"])
+	for i := 0; i+22 <= len(inst)-22; i += 22 {
+		b := inst[i : i+44]
+		from := int(binary.LittleEndian.Uint16(b[20:]))
+		to := int(binary.LittleEndian.Uint16(b[22+20:]))
+		if from > to || to > len(instrumentZones) {
+			return nil, fmt.Errorf("invalid instrument zones")
+		}
+		sf.instruments = append(sf.instruments, &sf2InstrumentHeader{
+			name:  sf2Name(b[0:20]),
+			zones: instrumentZones[from:to],
+		})
+	}
+	return sf, nil
+}
+
+// collects sub chunks in LIST chunks
+func readSF2Chunks(data []byte, chunks map[string][]byte) {
+	for pos := 0; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+		if pos+size > len(data) {
+			size = len(data) - pos
+		}
+		if id == "LIST" && size >= 4 {
+			readSF2Chunks(data[pos+4:pos+size], chunks)
+		} else {
+			chunks[id] = data[pos : pos+size]
+		}
+		pos += size + size%2
+	}
+}
+
+// one zone per bag except the terminal one
+func readSF2Zones(bag []byte, gen []byte) []sf2Zone {
+	zones := make([]sf2Zone, 0)
+	for i := 0; i+8 <= len(bag); i += 4 {
+		from := int(binary.LittleEndian.Uint16(bag[i:]))
+		to := int(binary.LittleEndian.Uint16(bag[i+4:]))
+		zone := make(sf2Zone)
+		for j := from; j < to && j*4+4 <= len(gen); j++ {
+			oper := int(binary.LittleEndian.Uint16(gen[j*4:]))
+			amount := int(int16(binary.LittleEndian.Uint16(gen[j*4+2:])))
+			if oper == genKeyRange || oper == genVelRange {
+				amount = int(gen[j*4+2]) | int(gen[j*4+3])<<8
+			}
+			zone[oper] = amount
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+func sf2Name(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+// returns global and non-global zones having the terminal generator
+func splitSF2Zones(zones []sf2Zone, terminal int) (sf2Zone, []sf2Zone) {
+	global := make(sf2Zone)
+	if len(zones) > 0 {
+		if _, ok := zones[0][terminal]; !ok {
+			global = zones[0]
+			zones = zones[1:]
+		}
+	}
+	result := make([]sf2Zone, 0, len(zones))
+	for _, z := range zones {
+		if _, ok := z[terminal]; ok {
+			result = append(result, z)
+		}
+	}
+	return global, result
+}
+
+// merges the global zone into a local one
+func mergeSF2Zones(global sf2Zone, local sf2Zone) sf2Zone {
+	merged := make(sf2Zone)
+	for k, v := range global {
+		merged[k] = v
+	}
+	for k, v := range local {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (sf *soundFont) preset(bank int, program int) (*sf2Preset, error) {
+	var header *sf2PresetHeader
+	for _, p := range sf.presets {
+		if p.bank == bank && p.program == program {
+			header = p
+			break
+		}
+	}
+	if header == nil {
+		return nil, fmt.Errorf("preset %v:%v not found", bank, program)
+	}
+	instrument := &sampleInstrument{name: header.name}
+	var first sf2Zone
+	presetGlobal, presetZones := splitSF2Zones(header.zones, genInstrument)
+	for _, pz := range presetZones {
+		pz = mergeSF2Zones(presetGlobal, pz)
+		index := pz.get(genInstrument)
+		if index < 0 || index >= len(sf.instruments) {
+			return nil, fmt.Errorf("invalid instrument %v", index)
+		}
+		instGlobal, instZones := splitSF2Zones(sf.instruments[index].zones, genSampleID)
+		for _, iz := range instZones {
+			iz = mergeSF2Zones(instGlobal, iz)
+			region, err := sf.region(pz, iz)
+			if err != nil {
+				return nil, err
+			}
+			if region == nil {
+				continue
+			}
+			if first == nil {
+				first = iz
+			}
+			instrument.regions = append(instrument.regions, region)
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("preset %v:%v has no samples", bank, program)
+	}
+	return &sf2Preset{
+		instrument:   instrument,
+		adsrParams:   sf2ToAdsrParams(first),
+		filterParams: sf2ToFilterParams(first),
+	}, nil
+}
+
+// returns nil if the ranges of the zones do not overlap
+func (sf *soundFont) region(pz sf2Zone, iz sf2Zone) (*sampleRegion, error) {
+	index := iz.get(genSampleID)
+	if index < 0 || index >= len(sf.samples) {
+		return nil, fmt.Errorf("invalid sample %v", index)
+	}
+	s := sf.samples[index]
+	start := s.start + iz.get(genStartAddrsOffset) + iz.get(genStartAddrsCoarseOffset)*32768
+	end := s.end + iz.get(genEndAddrsOffset) + iz.get(genEndAddrsCoarseOffset)*32768
+	startLoop := s.startLoop + iz.get(genStartloopAddrsOffset) + iz.get(genStartloopAddrsCoarseOffset)*32768
+	endLoop := s.endLoop + iz.get(genEndloopAddrsOffset) + iz.get(genEndloopAddrsCoarseOffset)*32768
+	if start < 0 || end > len(sf.data) || start >= end {
+		return nil, fmt.Errorf("invalid sample range of %v", s.name)
+	}
+	lokey, hikey := intersectSF2Ranges(pz, iz, genKeyRange)
+	lovel, hivel := intersectSF2Ranges(pz, iz, genVelRange)
+	if lokey > hikey || lovel > hivel {
+		return nil, nil
+	}
+	keycenter := iz.get(genOverridingRootKey)
+	if keycenter < 0 {
+		keycenter = s.originalPitch
+	}
+	if keycenter > 127 {
+		keycenter = 60
+	}
+	loopMode := loopNone
+	switch iz.get(genSampleModes) {
+	case 1:
+		loopMode = loopContinuous
+	case 3:
+		loopMode = loopSustain
+	}
+	// the end of a loop is the first sample following the loop
+	loopStart := startLoop - start
+	loopEnd := endLoop - start - 1
+	if loopStart < 0 || loopEnd >= end-start || loopStart > loopEnd {
+		loopMode = loopNone
+		loopStart = 0
+		loopEnd = end - start - 1
+	}
+	return &sampleRegion{
+		sample: &sample{
+			values:     sf.data[start:end],
+			sampleRate: s.sampleRate,
+		},
+		lokey:     lokey,
+		hikey:     hikey,
+		lovel:     lovel,
+		hivel:     hivel,
+		keycenter: keycenter,
+		tune:      pz.get(genFineTune) + iz.get(genFineTune) + s.pitchCorrection,
+		transpose: pz.get(genCoarseTune) + iz.get(genCoarseTune),
+		gain:      math.Pow(10, -float64(pz.get(genInitialAttenuation)+iz.get(genInitialAttenuation))/200),
+		loopMode:  loopMode,
+		loopStart: loopStart,
+		loopEnd:   loopEnd,
+	}, nil
+}
+func intersectSF2Ranges(pz sf2Zone, iz sf2Zone, oper int) (int, int) {
+	plo, phi := pz.rangeOf(oper)
+	ilo, ihi := iz.rangeOf(oper)
+	lo := int(math.Max(float64(plo), float64(ilo)))
+	hi := int(math.Min(float64(phi), float64(ihi)))
+	return lo, hi
+}
+
+// timecents to ms
+func timecentsToMillis(tc int) float64 {
+	return math.Pow(2, float64(tc)/1200) * 1000
+}
+
+// delay and hold are approximated by attack and decay
+func sf2ToAdsrParams(z sf2Zone) *adsrParams {
+	return &adsrParams{
+		attack:  timecentsToMillis(z.get(genDelayVolEnv)) + timecentsToMillis(z.get(genAttackVolEnv)),
+		decay:   timecentsToMillis(z.get(genHoldVolEnv)) + timecentsToMillis(z.get(genDecayVolEnv)),
+		sustain: math.Pow(10, -float64(z.get(genSustainVolEnv))/200),
+		release: timecentsToMillis(z.get(genReleaseVolEnv)),
+	}
+}
+
+// nil if the filter is fully open
+func sf2ToFilterParams(z sf2Zone) *filterParams {
+	fc := z.get(genInitialFilterFc)
+	if fc >= 13500 {
+		return nil
+	}
+	return &filterParams{
+		enabled:   true,
+		targetOsc: targetOscAll,
+		kind:      filterLowPass,
+		freq:      8.176 * math.Pow(2, float64(fc)/1200),
+		q:         math.Pow(10, float64(z.get(genInitialFilterQ))/200) / math.Sqrt2,
+		N:         50,
+	}
+}
+
+// ----- SoundFont Loading ----- //
+
+// loaded SoundFonts by path (under samplesLock)
+var soundFonts = make(map[string]*soundFont)
+
+func loadSoundFont(path string) (*soundFont, error) {
+	samplesLock.Lock()
+	defer samplesLock.Unlock()
+	if sf, ok := soundFonts[path]; ok {
+		return sf, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sf, err := readSoundFont(file)
+	if err != nil {
+		return nil, err
+	}
+	soundFonts[path] = sf
+	return sf, nil
+}
+
+type sf2PresetJSON struct {
+	Name    string `json:"name"`
+	Bank    int    `json:"bank"`
+	Program int    `json:"program"`
+}
+type sf2ListJSON struct {
+	Path    string           `json:"path"`
+	Presets []*sf2PresetJSON `json:"presets"`
+}
+
+func (sf *soundFont) listToJSON(path string) json.RawMessage {
+	presets := make([]*sf2PresetJSON, len(sf.presets))
+	for i, p := range sf.presets {
+		presets[i] = &sf2PresetJSON{Name: p.name, Bank: p.bank, Program: p.program}
+	}
+	sort.SliceStable(presets, func(i, j int) bool {
+		if presets[i].Bank != presets[j].Bank {
+			return presets[i].Bank < presets[j].Bank
+		}
+		return presets[i].Program < presets[j].Program
+	})
+	return toRawMessage(&sf2ListJSON{
+		Path:    path,
+		Presets: presets,
+	})
+}
+
+func loadSF2Preset(path string, bank int, program int) (*sf2Preset, error) {
+	sf, err := loadSoundFont(path)
+	if err != nil {
+		return nil, err
+	}
+	return sf.preset(bank, program)
+}
+
+// plays the preset with osc0 replacing the sound source, the envelope and the filter
+func (p *params) applySF2Preset(path string, bank int, program int) error {
+	preset, err := loadSF2Preset(path, bank, program)
+	if err != nil {
+		return err
+	}
+	for i, o := range p.oscParams {
+		o.enabled = i == 0
+	}
+	o := p.oscParams[0]
+	o.kind = waveSample
+	o.octave = 0
+	o.coarse = 0
+	o.fine = 0
+	o.level = 1
+	err = o.setSF2(path, bank, program)
+	if err != nil {
+		return err
+	}
+	p.fmParams.enabled = false
+	*p.adsrParams = *preset.adsrParams
+	if preset.filterParams != nil {
+		*p.filterParams = *preset.filterParams
+	} else {
+		p.filterParams.enabled = false
+	}
+	return nil
+}
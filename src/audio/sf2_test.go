@@ -0,0 +1,165 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testSF2Gen struct {
+	oper   uint16
+	amount int16
+}
+
+func sf2Chunk(id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+func sf2ListChunk(kind string, chunks ...[]byte) []byte {
+	data := []byte(kind)
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return sf2Chunk("LIST", data)
+}
+func sf2Records(records ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, r := range records {
+		binary.Write(&b, binary.LittleEndian, r)
+	}
+	return b.Bytes()
+}
+
+// a preset with an instrument having a global zone and 2 zones sharing a looped sample
+func makeTestSF2() []byte {
+	samples := make([]int16, 100)
+	for i := range samples {
+		samples[i] = int16(i * 100)
+	}
+	type phdr struct {
+		Name                       [20]byte
+		Preset, Bank, BagIndex     uint16
+		Library, Genre, Morphology uint32
+	}
+	type inst struct {
+		Name     [20]byte
+		BagIndex uint16
+	}
+	type bag struct{ Gen, Mod uint16 }
+	type shdr struct {
+		Name                                 [20]byte
+		Start, End, StartLoop, EndLoop, Rate uint32
+		OriginalPitch                        uint8
+		PitchCorrection                      int8
+		Link, Type                           uint16
+	}
+	name := func(s string) [20]byte {
+		var n [20]byte
+		copy(n[:], s)
+		return n
+	}
+	pgen := []testSF2Gen{{genInstrument, 0}, {0, 0}}
+	igen := []testSF2Gen{
+		{genAttackVolEnv, 0}, {genSustainVolEnv, 200}, {genReleaseVolEnv, 1200}, {genInitialFilterFc, 6900},
+		{genKeyRange, 59 << 8}, {genSampleModes, 1}, {genSampleID, 0},
+		{genKeyRange, 127<<8 | 60}, {genOverridingRootKey, 72}, {genCoarseTune, -1}, {genSampleID, 0},
+		{0, 0},
+	}
+	pdta := sf2ListChunk("pdta",
+		sf2Chunk("phdr", sf2Records(phdr{Name: name("Piano"), Preset: 3, Bank: 1}, phdr{Name: name("EOP"), BagIndex: 1})),
+		sf2Chunk("pbag", sf2Records(bag{0, 0}, bag{1, 0})),
+		sf2Chunk("pmod", make([]byte, 10)),
+		sf2Chunk("pgen", sf2Records(pgen)),
+		sf2Chunk("inst", sf2Records(inst{name("Piano Inst"), 0}, inst{name("EOI"), 3})),
+		sf2Chunk("ibag", sf2Records(bag{0, 0}, bag{4, 0}, bag{7, 0}, bag{11, 0})),
+		sf2Chunk("imod", make([]byte, 10)),
+		sf2Chunk("igen", sf2Records(igen)),
+		sf2Chunk("shdr", sf2Records(
+			shdr{Name: name("C4"), Start: 10, End: 90, StartLoop: 20, EndLoop: 80, Rate: 22050, OriginalPitch: 60, PitchCorrection: 5},
+			shdr{Name: name("EOS")},
+		)),
+	)
+	data := []byte("sfbk")
+	data = append(data, sf2ListChunk("INFO", sf2Chunk("ifil", []byte{2, 0, 1, 0}))...)
+	data = append(data, sf2ListChunk("sdta", sf2Chunk("smpl", sf2Records(samples)))...)
+	data = append(data, pdta...)
+	return sf2Chunk("RIFF", data)
+}
+
+func TestReadSoundFont(t *testing.T) {
+	sf, err := readSoundFont(bytes.NewReader(makeTestSF2()))
+	expectNoError(t, err)
+	expectEqual(t, len(sf.presets), 1)
+	expectEqual(t, len(sf.instruments), 1)
+	expectEqual(t, len(sf.samples), 1)
+	expectEqual(t, sf.presets[0].name, "Piano")
+	expectEqual(t, len(sf.instruments[0].zones), 3)
+
+	var list sf2ListJSON
+	expectNoError(t, json.Unmarshal(sf.listToJSON("a.sf2"), &list))
+	expectEqual(t, list.Presets[0].Name, "Piano")
+	expectEqual(t, list.Presets[0].Bank, 1)
+	expectEqual(t, list.Presets[0].Program, 3)
+
+	_, err = sf.preset(0, 0)
+	expectEqual(t, err != nil, true)
+	preset, err := sf.preset(1, 3)
+	expectNoError(t, err)
+	regions := preset.instrument.regions
+	expectEqual(t, len(regions), 2)
+	r := regions[0]
+	expectEqual(t, r.hikey, 59)
+	expectEqual(t, r.keycenter, 60)
+	expectEqual(t, r.tune, 5)
+	expectEqual(t, r.loopMode, loopContinuous)
+	expectEqual(t, r.loopStart, 10)
+	expectEqual(t, r.loopEnd, 69)
+	expectEqual(t, len(r.sample.values), 80)
+	expectNearlyEqual(t, r.sample.values[0], 1000.0/32768)
+	expectEqual(t, r.sample.sampleRate, 22050)
+	r = regions[1]
+	expectEqual(t, r.lokey, 60)
+	expectEqual(t, r.keycenter, 72)
+	expectEqual(t, r.transpose, -1)
+	expectEqual(t, r.loopMode, loopNone)
+
+	expectNearlyEqual(t, preset.adsrParams.attack, 1000+1000*math.Pow(2, -10)) // with the default delay
+	expectNearlyEqual(t, preset.adsrParams.sustain, 0.1)
+	expectNearlyEqual(t, preset.adsrParams.release, 2000)
+	expectEqual(t, preset.filterParams.kind, filterLowPass)
+	expectNearlyEqual(t, math.Round(preset.filterParams.freq), 440)
+
+	_, err = readSoundFont(bytes.NewReader([]byte("RIFF0000WAVE")))
+	expectEqual(t, err != nil, true)
+}
+
+func TestApplySF2Preset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sf2")
+	expectNoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.sf2")
+	expectNoError(t, ioutil.WriteFile(path, makeTestSF2(), 0644))
+	p := newParams()
+	p.oscParams[1].enabled = true
+	expectNoError(t, p.applySF2Preset(path, 1, 3))
+	expectEqual(t, p.oscParams[0].kind, waveSample)
+	expectEqual(t, p.oscParams[1].enabled, false)
+	expectEqual(t, len(p.oscParams[0].instrument.regions), 2)
+	expectNearlyEqual(t, p.adsrParams.release, 2000)
+	expectEqual(t, p.filterParams.enabled, true)
+
+	p2 := newParams()
+	p2.applyJSON(p.toJSON())
+	expectEqual(t, p2.oscParams[0].sf2, path)
+	expectEqual(t, p2.oscParams[0].sf2Program, 3)
+	expectEqual(t, len(p2.oscParams[0].instrument.regions), 2)
+	expectEqual(t, p.applySF2Preset(path, 0, 0) != nil, true)
+}
@@ -0,0 +1,300 @@
+package audio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ----- Loop Mode ----- //
+
+//go:generate go run ../gen/main.go -- loop_mode.gen.go
+/*
+generate-enum loopMode
+
+loopNone no_loop
+loopOneShot one_shot
+loopContinuous loop_continuous
+loopSustain loop_sustain
+
+EOF
+*/
+
+// ----- Sample Instrument ----- //
+
+type sample struct {
+	values     []float64 // the first channel
+	sampleRate int
+}
+type sampleRegion struct {
+	sample    *sample
+	lokey     int
+	hikey     int
+	lovel     int
+	hivel     int
+	keycenter int
+	tune      int     // cent
+	transpose int     // semitone
+	gain      float64 // from volume (dB)
+	loopMode  int
+	loopStart int
+	loopEnd   int // inclusive
+}
+
+type sampleInstrument struct {
+	name    string
+	regions []*sampleRegion
+}
+
+// the first region matching the note and the velocity (layers are not supported)
+func (s *sampleInstrument) region(note int, velocity int) *sampleRegion {
+	for _, r := range s.regions {
+		if note >= r.lokey && note <= r.hikey && velocity >= r.lovel && velocity <= r.hivel {
+			return r
+		}
+	}
+	return nil
+}
+
+// loaded instruments and samples by path
+// (loaded before locking the state so that the audio thread is not blocked)
+var sampleInstruments = make(map[string]*sampleInstrument)
+var samples = make(map[string]*sample)
+var samplesLock sync.Mutex
+
+func loadSampleInstrument(path string) (*sampleInstrument, error) {
+	samplesLock.Lock()
+	defer samplesLock.Unlock()
+	if s, ok := sampleInstruments[path]; ok {
+		return s, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s, err := readSfz(file, filepath.Dir(path), loadSample)
+	if err != nil {
+		return nil, err
+	}
+	s.name = filepath.Base(path)
+	sampleInstruments[path] = s
+	return s, nil
+}
+
+// called under samplesLock
+func loadSample(path string) (*sample, error) {
+	if s, ok := samples[path]; ok {
+		return s, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	values, format, err := readWav(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	s := &sample{
+		values:     values,
+		sampleRate: format.sampleRate,
+	}
+	samples[path] = s
+	return s, nil
+}
+
+// ----- SFZ ----- //
+
+var sfzHeader = regexp.MustCompile(`<(\w+)>`)
+var sfzOpcode = regexp.MustCompile(`(\w+)=`)
+
+// supports <control>, <global>, <master>, <group> and <region> with a subset of opcodes
+func readSfz(r io.Reader, dir string, loadSample func(path string) (*sample, error)) (*sampleInstrument, error) {
+	instrument := &sampleInstrument{}
+	defaultPath := ""
+	// opcodes by header level
+	levels := map[string]int{"control": 0, "global": 1, "master": 2, "group": 3, "region": 4}
+	opcodes := make([]map[string]string, len(levels))
+	level := -1
+	flush := func() error {
+		if level != levels["region"] {
+			return nil
+		}
+		merged := make(map[string]string)
+		for _, o := range opcodes[1:] {
+			for k, v := range o {
+				merged[k] = v
+			}
+		}
+		region, err := newSampleRegion(merged, filepath.Join(dir, defaultPath), loadSample)
+		if err != nil {
+			return err
+		}
+		instrument.regions = append(instrument.regions, region)
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		// split the line by headers
+		headers := sfzHeader.FindAllStringSubmatchIndex(line, -1)
+		starts := []int{0}
+		for _, h := range headers {
+			starts = append(starts, h[0])
+		}
+		for i, start := range starts {
+			end := len(line)
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			text := line[start:end]
+			if i > 0 {
+				h := headers[i-1]
+				name := line[h[2]:h[3]]
+				next, ok := levels[name]
+				if !ok {
+					return nil, fmt.Errorf("unsupported header <%v>", name)
+				}
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				for l := next; l < len(opcodes); l++ {
+					opcodes[l] = make(map[string]string)
+				}
+				level = next
+				text = line[h[1]:end]
+			}
+			// a value continues until the next opcode (sample paths may contain spaces)
+			matches := sfzOpcode.FindAllStringSubmatchIndex(text, -1)
+			for j, m := range matches {
+				valueEnd := len(text)
+				if j+1 < len(matches) {
+					valueEnd = matches[j+1][0]
+				}
+				key := text[m[2]:m[3]]
+				value := strings.TrimSpace(text[m[1]:valueEnd])
+				if level < 0 {
+					return nil, fmt.Errorf("opcode %v outside of headers", key)
+				}
+				if level == levels["control"] && key == "default_path" {
+					defaultPath = strings.ReplaceAll(value, "\\", "/")
+				}
+				opcodes[level][key] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(instrument.regions) == 0 {
+		return nil, fmt.Errorf("no regions found")
+	}
+	return instrument, nil
+}
+
+func newSampleRegion(opcodes map[string]string, dir string, loadSample func(path string) (*sample, error)) (*sampleRegion, error) {
+	path, ok := opcodes["sample"]
+	if !ok {
+		return nil, fmt.Errorf("sample is required for regions")
+	}
+	s, err := loadSample(filepath.Join(dir, strings.ReplaceAll(path, "\\", "/")))
+	if err != nil {
+		return nil, err
+	}
+	r := &sampleRegion{
+		sample:    s,
+		lokey:     0,
+		hikey:     127,
+		lovel:     1,
+		hivel:     127,
+		keycenter: 60,
+		gain:      1,
+		loopMode:  loopNone,
+		loopStart: 0,
+		loopEnd:   len(s.values) - 1,
+	}
+	for key, value := range opcodes {
+		var err error
+		switch key {
+		case "key":
+			r.lokey, err = parseSfzNote(value)
+			r.hikey = r.lokey
+			if _, ok := opcodes["pitch_keycenter"]; !ok {
+				r.keycenter = r.lokey
+			}
+		case "lokey":
+			r.lokey, err = parseSfzNote(value)
+		case "hikey":
+			r.hikey, err = parseSfzNote(value)
+		case "pitch_keycenter":
+			r.keycenter, err = parseSfzNote(value)
+		case "lovel":
+			r.lovel, err = strconv.Atoi(value)
+		case "hivel":
+			r.hivel, err = strconv.Atoi(value)
+		case "tune":
+			r.tune, err = strconv.Atoi(value)
+		case "transpose":
+			r.transpose, err = strconv.Atoi(value)
+		case "volume":
+			var volume float64
+			volume, err = strconv.ParseFloat(value, 64)
+			r.gain = math.Pow(10, volume/20)
+		case "loop_mode", "loopmode":
+			r.loopMode = loopModeFromString(value)
+		case "loop_start", "loopstart":
+			r.loopStart, err = strconv.Atoi(value)
+		case "loop_end", "loopend":
+			r.loopEnd, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid opcode %v=%v", key, value)
+		}
+	}
+	if r.loopStart < 0 || r.loopEnd >= len(s.values) || r.loopStart > r.loopEnd {
+		return nil, fmt.Errorf("invalid loop %v-%v", r.loopStart, r.loopEnd)
+	}
+	return r, nil
+}
+
+// MIDI number or name like c4 (= 60), c#4, db4
+func parseSfzNote(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	s = strings.ToLower(s)
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid note %v", s)
+	}
+	pitchClass := strings.Index("c d ef g a b", s[0:1])
+	if pitchClass < 0 {
+		return 0, fmt.Errorf("invalid note %v", s)
+	}
+	s = s[1:]
+	if s[0] == '#' {
+		pitchClass++
+		s = s[1:]
+	} else if s[0] == 'b' {
+		pitchClass--
+		s = s[1:]
+	}
+	octave, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid note %v", s)
+	}
+	return (octave+1)*12 + pitchClass, nil
+}
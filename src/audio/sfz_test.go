@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSfzNote(t *testing.T) {
+	for s, expected := range map[string]int{"60": 60, "c4": 60, "C#4": 61, "db4": 61, "a4": 69, "bb3": 58, "c-1": 0} {
+		note, err := parseSfzNote(s)
+		expectNoError(t, err)
+		expectEqual(t, note, expected)
+	}
+	_, err := parseSfzNote("h4")
+	expectEqual(t, err != nil, true)
+}
+
+func TestReadSfz(t *testing.T) {
+	sfz := `
+// comment
+<control> default_path=samples\
+<global> volume=-6
+<group> lovel=1 hivel=63 loop_mode=loop_continuous
+<region> sample=Piano C4.wav key=c4 loop_start=1 loop_end=2
+<region> sample=Piano E4.wav lokey=d4 hikey=f4 pitch_keycenter=e4
+<group> lovel=64
+<region> sample=Loud.wav volume=0 tune=-10 transpose=12
+`
+	loaded := []string{}
+	s, err := readSfz(strings.NewReader(sfz), "dir", func(path string) (*sample, error) {
+		loaded = append(loaded, path)
+		return &sample{values: make([]float64, 4), sampleRate: sampleRate}, nil
+	})
+	expectNoError(t, err)
+	expectEqual(t, len(s.regions), 3)
+	expectEqual(t, strings.Join(loaded, ","), "dir/samples/Piano C4.wav,dir/samples/Piano E4.wav,dir/samples/Loud.wav")
+
+	r := s.regions[0]
+	expectEqual(t, r.lokey, 60)
+	expectEqual(t, r.hikey, 60)
+	expectEqual(t, r.keycenter, 60)
+	expectNearlyEqual(t, r.gain, 0.501187)
+	expectEqual(t, r.loopMode, loopContinuous)
+	expectEqual(t, r.loopStart, 1)
+	expectEqual(t, r.loopEnd, 2)
+	r = s.regions[1]
+	expectEqual(t, r.keycenter, 64)
+	expectEqual(t, r.loopEnd, 3)
+	r = s.regions[2]
+	expectEqual(t, r.loopMode, loopNone)
+	expectEqual(t, r.gain, 1.0)
+	expectEqual(t, r.tune, -10)
+	expectEqual(t, r.transpose, 12)
+
+	expectEqual(t, s.region(60, 10), s.regions[0])
+	expectEqual(t, s.region(62, 10), s.regions[1])
+	expectEqual(t, s.region(62, 100), s.regions[2])
+	expectEqual(t, s.region(61, 10) == nil, true)
+
+	_, err = readSfz(strings.NewReader("<region> key=60"), "", nil)
+	expectEqual(t, err != nil, true)
+	_, err = readSfz(strings.NewReader("<curve> foo=1"), "", nil)
+	expectEqual(t, err != nil, true)
+}
+
+func TestLoadSampleInstrument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sfz")
+	expectNoError(t, err)
+	defer os.RemoveAll(dir)
+	expectNoError(t, ioutil.WriteFile(filepath.Join(dir, "a.wav"), makeTestWav([]float64{0, 0.5, -0.5, 1}), 0644))
+	path := filepath.Join(dir, "a.sfz")
+	expectNoError(t, ioutil.WriteFile(path, []byte("<region> sample=a.wav"), 0644))
+	p := newOscParams()
+	expectNoError(t, p.set("sfz", path))
+	expectEqual(t, p.instrument.name, "a.sfz")
+	expectEqual(t, len(p.instrument.regions[0].sample.values), 4)
+	p2 := newOscParams()
+	p2.applyJSON(p.toJSON())
+	expectEqual(t, p2.instrument, p.instrument)
+	// the current instrument is kept on errors
+	expectEqual(t, p.set("sfz", filepath.Join(dir, "not_found.sfz")) != nil, true)
+	expectEqual(t, p.sfz, path)
+	expectEqual(t, p2.instrument, p.instrument)
+	expectNoError(t, p.set("sfz", ""))
+	expectEqual(t, p.instrument == nil, true)
+}
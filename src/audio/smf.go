@@ -0,0 +1,318 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ----- Standard MIDI File ----- //
+
+type smfEvent struct {
+	tick  int
+	track int
+	data  []byte
+}
+type smfTempo struct {
+	tick          int
+	usPerQuarter  int
+	startsAtInSec float64
+}
+type smfTimeSignature struct {
+	tick        int
+	numerator   int
+	denominator int
+	startsAtBar int
+}
+
+type smf struct {
+	format         int
+	division       int // ticks per quarter note
+	events         []*smfEvent
+	tempos         []*smfTempo         // sorted, tempos[0].tick == 0
+	timeSignatures []*smfTimeSignature // sorted, timeSignatures[0].tick == 0
+	length         int                 // ticks
+}
+
+func loadSMF(path string) (*smf, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readSMF(bufio.NewReader(file))
+}
+
+func readSMF(r io.Reader) (*smf, error) {
+	var chunkType [4]byte
+	var chunkLength uint32
+	if err := binary.Read(r, binary.BigEndian, &chunkType); err != nil {
+		return nil, err
+	}
+	if string(chunkType[:]) != "MThd" {
+		return nil, fmt.Errorf("not a standard MIDI file")
+	}
+	if err := binary.Read(r, binary.BigEndian, &chunkLength); err != nil {
+		return nil, err
+	}
+	header := make([]byte, chunkLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if len(header) < 6 {
+		return nil, fmt.Errorf("invalid header length %v", len(header))
+	}
+	s := &smf{
+		format:   int(binary.BigEndian.Uint16(header[0:2])),
+		division: int(binary.BigEndian.Uint16(header[4:6])),
+	}
+	numTracks := int(binary.BigEndian.Uint16(header[2:4]))
+	if s.format > 1 {
+		return nil, fmt.Errorf("format %v is not supported", s.format)
+	}
+	if s.division&0x8000 != 0 {
+		return nil, fmt.Errorf("SMPTE time division is not supported")
+	}
+	if s.division == 0 {
+		return nil, fmt.Errorf("invalid time division")
+	}
+	for track := 0; track < numTracks; {
+		if err := binary.Read(r, binary.BigEndian, &chunkType); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &chunkLength); err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, chunkLength)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		if string(chunkType[:]) != "MTrk" {
+			continue // unknown chunks should be ignored
+		}
+		if err := s.readTrack(track, chunk); err != nil {
+			return nil, fmt.Errorf("track %v: %v", track, err)
+		}
+		track++
+	}
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].tick < s.events[j].tick
+	})
+	s.makeTempoMap()
+	return s, nil
+}
+
+func (s *smf) readTrack(track int, chunk []byte) error {
+	pos := 0
+	tick := 0
+	var runningStatus byte
+	readVarLen := func() (int, error) {
+		value := 0
+		for i := 0; i < 4; i++ {
+			if pos >= len(chunk) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := chunk[pos]
+			pos++
+			value = value<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				return value, nil
+			}
+		}
+		return 0, fmt.Errorf("variable-length quantity too long")
+	}
+	for pos < len(chunk) {
+		delta, err := readVarLen()
+		if err != nil {
+			return err
+		}
+		tick += delta
+		if pos >= len(chunk) {
+			return io.ErrUnexpectedEOF
+		}
+		status := chunk[pos]
+		switch {
+		case status == 0xff:
+			pos++
+			if pos >= len(chunk) {
+				return io.ErrUnexpectedEOF
+			}
+			metaType := chunk[pos]
+			pos++
+			length, err := readVarLen()
+			if err != nil {
+				return err
+			}
+			if pos+length > len(chunk) {
+				return io.ErrUnexpectedEOF
+			}
+			data := chunk[pos : pos+length]
+			pos += length
+			switch metaType {
+			case 0x2f: // end of track
+				if tick > s.length {
+					s.length = tick
+				}
+				return nil
+			// invalid tempos and time signatures are ignored (falling back to 120 BPM and 4/4)
+			case 0x51: // tempo
+				if length == 3 {
+					usPerQuarter := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+					if usPerQuarter > 0 {
+						s.tempos = append(s.tempos, &smfTempo{tick: tick, usPerQuarter: usPerQuarter})
+					}
+				}
+			case 0x58: // time signature
+				if length == 4 && data[0] > 0 && data[1] <= 7 {
+					s.timeSignatures = append(s.timeSignatures, &smfTimeSignature{
+						tick:        tick,
+						numerator:   int(data[0]),
+						denominator: 1 << data[1],
+					})
+				}
+			}
+		case status == 0xf0 || status == 0xf7:
+			pos++
+			length, err := readVarLen()
+			if err != nil {
+				return err
+			}
+			pos += length // sysex is not played
+		case status > 0xf0:
+			// other system messages are not played (and cancel the running status)
+			pos += 1 + systemMessageLength(status)
+			if pos > len(chunk) {
+				return io.ErrUnexpectedEOF
+			}
+			runningStatus = 0
+		default:
+			if status&0x80 != 0 {
+				runningStatus = status
+				pos++
+			} else if runningStatus == 0 {
+				return fmt.Errorf("data byte without status")
+			}
+			length := 2
+			if runningStatus>>4 == 0xc || runningStatus>>4 == 0xd {
+				length = 1
+			}
+			if pos+length > len(chunk) {
+				return io.ErrUnexpectedEOF
+			}
+			data := make([]byte, length+1)
+			data[0] = runningStatus
+			copy(data[1:], chunk[pos:pos+length])
+			for _, b := range data[1:] {
+				if b >= 0x80 {
+					return fmt.Errorf("invalid data byte %#x", b)
+				}
+			}
+			pos += length
+			s.events = append(s.events, &smfEvent{tick: tick, track: track, data: data})
+		}
+		if tick > s.length {
+			s.length = tick
+		}
+	}
+	return nil
+}
+
+// number of data bytes of system common and real-time messages
+func systemMessageLength(status byte) int {
+	switch status {
+	case 0xf1, 0xf3:
+		return 1
+	case 0xf2:
+		return 2
+	}
+	return 0
+}
+
+func (s *smf) makeTempoMap() {
+	sort.SliceStable(s.tempos, func(i, j int) bool {
+		return s.tempos[i].tick < s.tempos[j].tick
+	})
+	if len(s.tempos) == 0 || s.tempos[0].tick > 0 {
+		s.tempos = append([]*smfTempo{{tick: 0, usPerQuarter: 500000}}, s.tempos...)
+	}
+	for i := 1; i < len(s.tempos); i++ {
+		prev := s.tempos[i-1]
+		s.tempos[i].startsAtInSec = prev.startsAtInSec + prev.ticksToSeconds(s.tempos[i].tick-prev.tick, s.division)
+	}
+	sort.SliceStable(s.timeSignatures, func(i, j int) bool {
+		return s.timeSignatures[i].tick < s.timeSignatures[j].tick
+	})
+	if len(s.timeSignatures) == 0 || s.timeSignatures[0].tick > 0 {
+		s.timeSignatures = append([]*smfTimeSignature{{tick: 0, numerator: 4, denominator: 4}}, s.timeSignatures...)
+	}
+	for i := 1; i < len(s.timeSignatures); i++ {
+		prev := s.timeSignatures[i-1]
+		bars := float64(s.timeSignatures[i].tick-prev.tick) / float64(prev.ticksPerBar(s.division))
+		s.timeSignatures[i].startsAtBar = prev.startsAtBar + int(bars+0.5)
+	}
+}
+
+func (t *smfTempo) ticksToSeconds(ticks int, division int) float64 {
+	return float64(ticks) * float64(t.usPerQuarter) / 1000000 / float64(division)
+}
+func (t *smfTimeSignature) ticksPerBar(division int) int {
+	ticks := division * 4 * t.numerator / t.denominator
+	if ticks < 1 {
+		return 1 // for very small divisions
+	}
+	return ticks
+}
+
+func (s *smf) tempoAtTick(tick int) *smfTempo {
+	i := sort.Search(len(s.tempos), func(i int) bool {
+		return s.tempos[i].tick > tick
+	})
+	return s.tempos[i-1]
+}
+func (s *smf) tempoAtSeconds(seconds float64) *smfTempo {
+	i := sort.Search(len(s.tempos), func(i int) bool {
+		return s.tempos[i].startsAtInSec > seconds
+	})
+	if i == 0 {
+		return s.tempos[0]
+	}
+	return s.tempos[i-1]
+}
+func (s *smf) tickToSeconds(tick int) float64 {
+	tempo := s.tempoAtTick(tick)
+	return tempo.startsAtInSec + tempo.ticksToSeconds(tick-tempo.tick, s.division)
+}
+func (s *smf) secondsToBeat(seconds float64) float64 {
+	tempo := s.tempoAtSeconds(seconds)
+	quarters := (seconds - tempo.startsAtInSec) * 1000000 / float64(tempo.usPerQuarter)
+	return float64(tempo.tick)/float64(s.division) + quarters
+}
+func (s *smf) beatToSeconds(beat float64) float64 {
+	tick := beat * float64(s.division)
+	tempo := s.tempoAtTick(int(tick))
+	quarters := (tick - float64(tempo.tick)) / float64(s.division)
+	return tempo.startsAtInSec + quarters*float64(tempo.usPerQuarter)/1000000
+}
+func (s *smf) bpmAtSeconds(seconds float64) float64 {
+	return 60000000 / float64(s.tempoAtSeconds(seconds).usPerQuarter)
+}
+
+// returns 0-based bar and beat (in units of the time signature's denominator)
+func (s *smf) barAndBeatAtBeat(beat float64) (int, float64) {
+	tick := int(beat * float64(s.division))
+	i := sort.Search(len(s.timeSignatures), func(i int) bool {
+		return s.timeSignatures[i].tick > tick
+	})
+	ts := s.timeSignatures[i-1]
+	ticks := beat*float64(s.division) - float64(ts.tick)
+	ticksPerBar := float64(ts.ticksPerBar(s.division))
+	bars := int(ticks / ticksPerBar)
+	ticksPerBeat := float64(s.division*4) / float64(ts.denominator)
+	return ts.startsAtBar + bars, (ticks - float64(bars)*ticksPerBar) / ticksPerBeat
+}
+func (s *smf) lengthInSeconds() float64 {
+	return s.tickToSeconds(s.length)
+}
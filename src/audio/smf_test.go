@@ -0,0 +1,147 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadSMF(t *testing.T) {
+	data := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6,
+		0, 1, // format 1
+		0, 2, // 2 tracks
+		0, 96, // 96 ticks per quarter note
+		// tempo track
+		'M', 'T', 'r', 'k', 0, 0, 0, 18,
+		0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20, // 120 bpm
+		0x60, 0xff, 0x51, 0x03, 0x0f, 0x42, 0x40, // 60 bpm at beat 1
+		0x00, 0xff, 0x2f, 0x00,
+		// note track (with running status)
+		'M', 'T', 'r', 'k', 0, 0, 0, 16,
+		0x00, 0x90, 60, 100,
+		0x60, 60, 0,
+		0x81, 0x40, 0x80, 62, 0,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+	song, err := readSMF(bytes.NewReader(data))
+	expectNoError(t, err)
+	if err != nil {
+		return
+	}
+	expectEqual(t, song.division, 96)
+	expectEqual(t, len(song.events), 3)
+	expectEqual(t, song.events[1].tick, 96)
+	expectEqual(t, song.events[1].data[0], byte(0x90))
+	expectEqual(t, song.events[2].tick, 288)
+	expectNearlyEqual(t, song.tickToSeconds(96), 0.5)
+	expectNearlyEqual(t, song.tickToSeconds(288), 2.5)
+	expectNearlyEqual(t, song.secondsToBeat(1.5), 2)
+	expectNearlyEqual(t, song.beatToSeconds(2), 1.5)
+	expectNearlyEqual(t, song.bpmAtSeconds(0.25), 120)
+	expectNearlyEqual(t, song.bpmAtSeconds(1.0), 60)
+	bar, beat := song.barAndBeatAtBeat(6)
+	expectEqual(t, bar, 1)
+	expectNearlyEqual(t, beat, 2)
+}
+
+func TestReadInvalidSMFMeta(t *testing.T) {
+	data := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6,
+		0, 0, // format 0
+		0, 1, // 1 track
+		0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 27,
+		0x00, 0xff, 0x51, 0x03, 0x00, 0x00, 0x00, // tempo 0
+		0x00, 0xff, 0x58, 0x04, 0x03, 0x40, 0x18, 0x08, // denominator 2^64
+		0x00, 0xff, 0x58, 0x04, 0x00, 0x02, 0x18, 0x08, // numerator 0
+		0x00, 0xff, 0x2f, 0x00,
+	}
+	song, err := readSMF(bytes.NewReader(data))
+	expectNoError(t, err)
+	if err != nil {
+		return
+	}
+	expectNearlyEqual(t, song.bpmAtSeconds(0), 120)
+	bar, beat := song.barAndBeatAtBeat(5)
+	expectEqual(t, bar, 1)
+	expectNearlyEqual(t, beat, 1)
+}
+
+func TestReadBrokenSMF(t *testing.T) {
+	header := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6,
+		0, 0, // format 0
+		0, 1, // 1 track
+		0, 96,
+	}
+	read := func(track ...byte) (*smf, error) {
+		data := append([]byte{}, header...)
+		data = append(data, 'M', 'T', 'r', 'k', 0, 0, 0, byte(len(track)))
+		data = append(data, track...)
+		return readSMF(bytes.NewReader(data))
+	}
+	// a status byte in place of a data byte
+	_, err := read(0x00, 0x90, 0x3c, 0x92, 0x00, 0xff, 0x2f, 0x00)
+	expectEqual(t, err != nil, true)
+
+	// system common messages are skipped without becoming the running status
+	song, err := read(
+		0x00, 0xf2, 0x01, 0x02, // song position pointer
+		0x00, 0xf6, // tune request
+		0x00, 0x90, 60, 100,
+		0x00, 0xff, 0x2f, 0x00,
+	)
+	expectNoError(t, err)
+	if err != nil {
+		return
+	}
+	expectEqual(t, len(song.events), 1)
+	expectEqual(t, song.events[0].data[0], byte(0x90))
+
+	_, err = read(0x00, 0xf3, 0x01, 0x00, 60, 100, 0x00, 0xff, 0x2f, 0x00)
+	expectEqual(t, err != nil, true)
+}
+
+func TestTransport(t *testing.T) {
+	song := &smf{
+		division: 96,
+		events: []*smfEvent{
+			{tick: 0, data: []byte{0x90, 60, 100}},
+			{tick: 48, data: []byte{0x80, 60, 0}},
+			{tick: 96, data: []byte{0x91, 62, 100}},
+		},
+		length: 192,
+	}
+	song.makeTempoMap()
+	tr := newTransport()
+	var sent [][]byte
+	var indices []int
+	send := func(index int, data []byte) {
+		sent = append(sent, data)
+		indices = append(indices, index)
+	}
+	tr.load("test.mid", song, send)
+	expectNoError(t, tr.play())
+	for i := 0; i < 12; i++ { // 12 * 1024 samples = 0.256 sec
+		tr.process(samplesPerCycle, send)
+	}
+	expectEqual(t, len(sent), 2)
+	expectEqual(t, indices[1], 12000%samplesPerCycle) // 0.25 sec
+	for i := 0; i < 36; i++ {
+		tr.process(samplesPerCycle, send)
+	}
+	// note on, note off, note on, then sustain off for each channel and the released note at the end
+	expectEqual(t, len(sent), 6)
+	expectEqual(t, sent[3][0], byte(0xb0))
+	expectEqual(t, sent[4][0], byte(0x81))
+	expectEqual(t, tr.playing, false)
+	expectEqual(t, tr.position, 0.0)
+}
+
+func TestIsProgramOrBankChange(t *testing.T) {
+	expectEqual(t, isProgramOrBankChange([]byte{0xc0, 1}), true)
+	expectEqual(t, isProgramOrBankChange([]byte{0xb3, ccBankSelectMSB, 1}), true)
+	expectEqual(t, isProgramOrBankChange([]byte{0xb3, ccBankSelectLSB, 1}), true)
+	expectEqual(t, isProgramOrBankChange([]byte{0xb3, 7, 1}), false)
+	expectEqual(t, isProgramOrBankChange([]byte{0x90, 60, 100}), false)
+}
@@ -6,6 +6,12 @@ const (
 	targetOscAll = iota
 	targetOsc0
 	targetOsc1
+	targetOsc2
+	targetOsc3
+	targetOsc4
+	targetOsc5
+	targetOsc6
+	targetOsc7
 )
 
 func targetOscFromString(s string) int {
@@ -16,6 +22,18 @@ func targetOscFromString(s string) int {
 		return targetOsc0
 	case "1":
 		return targetOsc1
+	case "2":
+		return targetOsc2
+	case "3":
+		return targetOsc3
+	case "4":
+		return targetOsc4
+	case "5":
+		return targetOsc5
+	case "6":
+		return targetOsc6
+	case "7":
+		return targetOsc7
 	}
 	return targetOscAll
 }
@@ -27,6 +45,18 @@ func targetOscToString(d int) string {
 		return "0"
 	case targetOsc1:
 		return "1"
+	case targetOsc2:
+		return "2"
+	case targetOsc3:
+		return "3"
+	case targetOsc4:
+		return "4"
+	case targetOsc5:
+		return "5"
+	case targetOsc6:
+		return "6"
+	case targetOsc7:
+		return "7"
 	}
 	return "all"
 }
@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ----- Transport ----- //
+
+const minLoopLength = 0.01 // sec
+
+type transport struct {
+	file      string
+	song      *smf
+	playing   bool
+	position  float64 // sec
+	cursor    int     // index of the next event to play
+	loop      bool
+	loopStart float64 // sec
+	loopEnd   float64 // sec
+	sounding  [16][128]bool
+	used      [16]bool
+}
+
+func newTransport() *transport {
+	return &transport{}
+}
+
+func (t *transport) load(file string, song *smf, send func(index int, data []byte)) {
+	t.releaseNotes(0, send)
+	t.file = file
+	t.song = song
+	t.playing = false
+	t.loop = false
+	t.seek(0)
+}
+func (t *transport) play() error {
+	if t.song == nil {
+		return fmt.Errorf("no MIDI file loaded")
+	}
+	t.playing = true
+	return nil
+}
+func (t *transport) stop(send func(index int, data []byte)) {
+	t.playing = false
+	t.releaseNotes(0, send)
+}
+func (t *transport) seekBeat(beat float64, send func(index int, data []byte)) error {
+	if t.song == nil {
+		return fmt.Errorf("no MIDI file loaded")
+	}
+	t.releaseNotes(0, send)
+	t.seek(t.song.beatToSeconds(math.Max(beat, 0)))
+	return nil
+}
+func (t *transport) setLoop(startBeat float64, endBeat float64) error {
+	if t.song == nil {
+		return fmt.Errorf("no MIDI file loaded")
+	}
+	start := t.song.beatToSeconds(math.Max(startBeat, 0))
+	end := t.song.beatToSeconds(endBeat)
+	if end-start < minLoopLength {
+		return fmt.Errorf("loop end should be after loop start")
+	}
+	t.loop = true
+	t.loopStart = start
+	t.loopEnd = end
+	return nil
+}
+func (t *transport) clearLoop() {
+	t.loop = false
+}
+
+func (t *transport) seek(seconds float64) {
+	t.position = seconds
+	if t.song == nil {
+		t.cursor = 0
+		return
+	}
+	events := t.song.events
+	t.cursor = sort.Search(len(events), func(i int) bool {
+		return t.song.tickToSeconds(events[i].tick) >= seconds
+	})
+}
+
+// sends events scheduled in the next `length` samples
+func (t *transport) process(length int, send func(index int, data []byte)) {
+	if !t.playing || t.song == nil {
+		return
+	}
+	start := 0
+	for start < length {
+		boundary := t.song.lengthInSeconds()
+		if t.loop && t.position < t.loopEnd {
+			boundary = t.loopEnd
+		}
+		end := t.position + float64(length-start)*secPerSample
+		wrapped := end >= boundary
+		if wrapped {
+			end = boundary
+		}
+		events := t.song.events
+		for ; t.cursor < len(events); t.cursor++ {
+			e := events[t.cursor]
+			seconds := t.song.tickToSeconds(e.tick)
+			if seconds >= end {
+				break
+			}
+			index := start + int(math.Round((seconds-t.position)*sampleRate))
+			if index < start {
+				index = start
+			}
+			if index >= length {
+				index = length - 1
+			}
+			t.track(e.data)
+			send(index, e.data)
+		}
+		start += int(math.Max(math.Ceil((end-t.position)*sampleRate), 0))
+		t.position = end
+		if wrapped {
+			index := start
+			if index >= length {
+				index = length - 1
+			}
+			t.releaseNotes(index, send)
+			if !t.loop {
+				t.playing = false
+				t.seek(0)
+				return
+			}
+			t.seek(t.loopStart)
+		}
+	}
+}
+
+func (t *transport) track(data []byte) {
+	channel := data[0] & 0x0f
+	t.used[channel] = true
+	switch data[0] >> 4 {
+	case 8:
+		t.sounding[channel][data[1]] = false
+	case 9:
+		t.sounding[channel][data[1]] = data[2] > 0
+	}
+}
+func (t *transport) releaseNotes(index int, send func(index int, data []byte)) {
+	for channel := range t.sounding {
+		if !t.used[channel] {
+			continue
+		}
+		for note, sounding := range t.sounding[channel] {
+			if sounding {
+				send(index, []byte{0x80 | byte(channel), byte(note), 0})
+				t.sounding[channel][note] = false
+			}
+		}
+		send(index, []byte{0xb0 | byte(channel), ccSustain, 0})
+		t.used[channel] = false
+	}
+}
+
+type transportJSON struct {
+	File      string  `json:"file"`
+	Playing   bool    `json:"playing"`
+	Position  float64 `json:"position"`
+	Length    float64 `json:"length"`
+	Beat      float64 `json:"beat"`
+	Bar       int     `json:"bar"`
+	BeatInBar float64 `json:"beatInBar"`
+	Bpm       float64 `json:"bpm"`
+	Loop      bool    `json:"loop"`
+	LoopStart float64 `json:"loopStart"`
+	LoopEnd   float64 `json:"loopEnd"`
+}
+
+func (t *transport) toJSON() *transportJSON {
+	if t.song == nil {
+		return nil
+	}
+	beat := t.song.secondsToBeat(t.position)
+	bar, beatInBar := t.song.barAndBeatAtBeat(beat)
+	return &transportJSON{
+		File:      t.file,
+		Playing:   t.playing,
+		Position:  t.position,
+		Length:    t.song.lengthInSeconds(),
+		Beat:      beat,
+		Bar:       bar + 1,
+		BeatInBar: beatInBar + 1,
+		Bpm:       t.song.bpmAtSeconds(t.position),
+		Loop:      t.loop,
+		LoopStart: t.song.secondsToBeat(t.loopStart),
+		LoopEnd:   t.song.secondsToBeat(t.loopEnd),
+	}
+}
@@ -0,0 +1,375 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ----- Tuning ----- //
+
+// 12-TET with A4 = 442Hz unless Scala files are loaded
+type tuning struct {
+	scaleName     string    // name of the .scl file, "" for 12-TET
+	description   string    // description in the .scl file
+	cents         []float64 // pitches of degree 1 ~ N, the last one is the period
+	mappingName   string    // name of the .kbm file, "" for the linear mapping
+	mapping       []int     // scale degree of each key in the pattern, -1 if unmapped
+	firstNote     int
+	lastNote      int
+	middleNote    int // where degree 0 is mapped
+	referenceNote int
+	referenceFreq float64
+	octaveDegree  int       // degrees per repetition of the mapping
+	freqs         []float64 // length: 128, 0 if unmapped
+}
+
+type tuningJSON struct {
+	ScaleName     string    `json:"scaleName"`
+	Description   string    `json:"description"`
+	Cents         []float64 `json:"cents"`
+	MappingName   string    `json:"mappingName"`
+	Mapping       []int     `json:"mapping"`
+	FirstNote     int       `json:"firstNote"`
+	LastNote      int       `json:"lastNote"`
+	MiddleNote    int       `json:"middleNote"`
+	ReferenceNote int       `json:"referenceNote"`
+	ReferenceFreq float64   `json:"referenceFreq"`
+	OctaveDegree  int       `json:"octaveDegree"`
+}
+
+func newTuning() *tuning {
+	t := &tuning{
+		freqs: make([]float64, 128),
+	}
+	t.resetScale()
+	t.resetMapping()
+	t.referenceFreq = baseFreq
+	t.update()
+	return t
+}
+func (t *tuning) resetScale() {
+	t.scaleName = ""
+	t.description = "12-TET"
+	t.cents = make([]float64, 12)
+	for i := range t.cents {
+		t.cents[i] = float64(i+1) * 100
+	}
+}
+func (t *tuning) resetMapping() {
+	t.mappingName = ""
+	t.mapping = make([]int, 0)
+	t.firstNote = 0
+	t.lastNote = 127
+	t.middleNote = 60
+	t.referenceNote = 69
+	t.octaveDegree = 0
+}
+func (t *tuning) applyJSON(data json.RawMessage) {
+	var j tuningJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil || len(j.Cents) == 0 || j.ReferenceFreq <= 0 {
+		log.Println("failed to apply JSON to tuning")
+		return
+	}
+	t.scaleName = j.ScaleName
+	t.description = j.Description
+	t.cents = j.Cents
+	t.mappingName = j.MappingName
+	t.mapping = j.Mapping
+	t.firstNote = j.FirstNote
+	t.lastNote = j.LastNote
+	t.middleNote = j.MiddleNote
+	t.referenceNote = j.ReferenceNote
+	t.referenceFreq = j.ReferenceFreq
+	t.octaveDegree = j.OctaveDegree
+	t.update()
+}
+func (t *tuning) toJSON() json.RawMessage {
+	return toRawMessage(&tuningJSON{
+		ScaleName:     t.scaleName,
+		Description:   t.description,
+		Cents:         t.cents,
+		MappingName:   t.mappingName,
+		Mapping:       t.mapping,
+		FirstNote:     t.firstNote,
+		LastNote:      t.lastNote,
+		MiddleNote:    t.middleNote,
+		ReferenceNote: t.referenceNote,
+		ReferenceFreq: t.referenceFreq,
+		OctaveDegree:  t.octaveDegree,
+	})
+}
+func (t *tuning) setReferenceFreq(freq float64) error {
+	if freq <= 0 {
+		return fmt.Errorf("invalid reference frequency %v", freq)
+	}
+	t.referenceFreq = freq
+	t.update()
+	return nil
+}
+
+// files are loaded before locking the state and then applied
+
+// returns a tuning that only has the scale
+func loadScale(path string) (*tuning, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	description, cents, err := readScl(file)
+	if err != nil {
+		return nil, err
+	}
+	s := newTuning()
+	s.scaleName = filepath.Base(path)
+	s.description = description
+	s.cents = cents
+	return s, nil
+}
+
+// returns a tuning that only has the mapping
+func loadMapping(path string) (*tuning, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	k, err := readKbm(file)
+	if err != nil {
+		return nil, err
+	}
+	k.mappingName = filepath.Base(path)
+	return k, nil
+}
+func (t *tuning) applyScale(s *tuning) {
+	t.scaleName = s.scaleName
+	t.description = s.description
+	t.cents = s.cents
+	t.update()
+}
+func (t *tuning) applyMapping(k *tuning) {
+	t.mappingName = k.mappingName
+	t.mapping = k.mapping
+	t.firstNote = k.firstNote
+	t.lastNote = k.lastNote
+	t.middleNote = k.middleNote
+	t.referenceNote = k.referenceNote
+	t.referenceFreq = k.referenceFreq
+	t.octaveDegree = k.octaveDegree
+	t.update()
+}
+
+func (t *tuning) update() {
+	referenceCents, ok := t.centsFromMiddle(t.referenceNote)
+	if !ok {
+		// the reference note is unmapped, so use the linear mapping only for it
+		referenceCents = t.degreeToCents(t.referenceNote - t.middleNote)
+	}
+	for note := range t.freqs {
+		cents, ok := t.centsFromMiddle(note)
+		if ok {
+			t.freqs[note] = t.referenceFreq * math.Pow(2, (cents-referenceCents)/1200)
+		} else {
+			t.freqs[note] = 0
+		}
+	}
+}
+func (t *tuning) centsFromMiddle(note int) (float64, bool) {
+	if note < t.firstNote || note > t.lastNote {
+		return 0, false
+	}
+	d := note - t.middleNote
+	if len(t.mapping) == 0 {
+		return t.degreeToCents(d), true
+	}
+	size := len(t.mapping)
+	repeats := floorDiv(d, size)
+	entry := t.mapping[d-repeats*size]
+	if entry < 0 {
+		return 0, false
+	}
+	octaveDegree := t.octaveDegree
+	if octaveDegree == 0 {
+		octaveDegree = len(t.cents)
+	}
+	return t.degreeToCents(repeats*octaveDegree + entry), true
+}
+func (t *tuning) degreeToCents(degree int) float64 {
+	n := len(t.cents)
+	period := t.cents[n-1]
+	octaves := floorDiv(degree, n)
+	index := degree - octaves*n
+	cents := float64(octaves) * period
+	if index > 0 {
+		cents += t.cents[index-1]
+	}
+	return cents
+}
+func floorDiv(a int, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// returns 0 if the note is unmapped
+func (t *tuning) freq(note int) float64 {
+	if note < 0 || note >= len(t.freqs) {
+		return 0
+	}
+	return t.freqs[note]
+}
+func (t *tuning) mapped(note int) bool {
+	return t.freq(note) > 0
+}
+
+// ----- Scala ----- //
+
+// lines starting with "!" are comments
+func readScalaLines(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// the first field of a line (the rest is ignored)
+func firstField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func readScl(r io.Reader) (string, []float64, error) {
+	lines, err := readScalaLines(r)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(lines) < 2 {
+		return "", nil, fmt.Errorf("invalid scale file")
+	}
+	description := strings.TrimSpace(lines[0])
+	count, err := strconv.ParseInt(firstField(lines[1]), 10, 64)
+	if err != nil {
+		return "", nil, err
+	}
+	if count <= 0 || int(count) > len(lines)-2 {
+		return "", nil, fmt.Errorf("invalid number of notes %v", count)
+	}
+	cents := make([]float64, count)
+	for i := range cents {
+		value, err := parsePitch(firstField(lines[i+2]))
+		if err != nil {
+			return "", nil, err
+		}
+		cents[i] = value
+	}
+	if cents[count-1] <= 0 {
+		return "", nil, fmt.Errorf("invalid period %v", cents[count-1])
+	}
+	return description, cents, nil
+}
+
+// "701.955" (cents), "3/2" or "2" (ratio)
+func parsePitch(s string) (float64, error) {
+	if strings.Contains(s, ".") {
+		return strconv.ParseFloat(s, 64)
+	}
+	fraction := strings.SplitN(s, "/", 2)
+	numerator, err := strconv.ParseInt(fraction[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	denominator := int64(1)
+	if len(fraction) == 2 {
+		denominator, err = strconv.ParseInt(fraction[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if numerator <= 0 || denominator <= 0 {
+		return 0, fmt.Errorf("invalid ratio %v", s)
+	}
+	return 1200 * math.Log2(float64(numerator)/float64(denominator)), nil
+}
+
+func readKbm(r io.Reader) (*tuning, error) {
+	lines, err := readScalaLines(r)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if field := firstField(line); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("invalid keyboard mapping file")
+	}
+	header := make([]int, 7)
+	for i := range header {
+		if i == 5 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		header[i] = int(value)
+	}
+	referenceFreq, err := strconv.ParseFloat(fields[5], 64)
+	if err != nil {
+		return nil, err
+	}
+	size := header[0]
+	if size < 0 || len(fields) < 7+size {
+		return nil, fmt.Errorf("invalid map size %v", size)
+	}
+	if referenceFreq <= 0 {
+		return nil, fmt.Errorf("invalid reference frequency %v", referenceFreq)
+	}
+	mapping := make([]int, size)
+	for i := range mapping {
+		field := fields[7+i]
+		if field == "x" {
+			mapping[i] = -1
+			continue
+		}
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		mapping[i] = int(value)
+	}
+	return &tuning{
+		mapping:       mapping,
+		firstNote:     header[1],
+		lastNote:      header[2],
+		middleNote:    header[3],
+		referenceNote: header[4],
+		referenceFreq: referenceFreq,
+		octaveDegree:  header[6],
+	}, nil
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDefaultTuning(t *testing.T) {
+	tuning := newTuning()
+	for note := 0; note < 128; note++ {
+		expectNearlyEqual(t, tuning.freq(note), noteToFreq(note))
+	}
+	expectNoError(t, tuning.setReferenceFreq(440))
+	expectNearlyEqual(t, tuning.freq(69), 440)
+	expectNearlyEqual(t, tuning.freq(81), 880)
+	expectNearlyEqual(t, tuning.freq(57), 220)
+}
+
+func TestScl(t *testing.T) {
+	scl := `! just.scl
+!
+Just intonation
+ 7
+!
+ 9/8
+ 5/4
+ 4/3
+ 3/2
+ 5/3
+ 15/8
+ 2/1
+`
+	description, cents, err := readScl(strings.NewReader(scl))
+	expectNoError(t, err)
+	expectEqual(t, description, "Just intonation")
+	expectEqual(t, len(cents), 7)
+	expectNearlyEqual(t, cents[3], 701.955000865)
+	expectNearlyEqual(t, cents[6], 1200)
+
+	tuning := newTuning()
+	tuning.cents = cents
+	tuning.update()
+	// the linear mapping: 7 keys per octave from C4 (60)
+	expectNearlyEqual(t, tuning.freq(69), baseFreq)
+	expectNearlyEqual(t, tuning.freq(67), tuning.freq(60)*2)
+	expectNearlyEqual(t, tuning.freq(64), tuning.freq(60)*3/2)
+
+	_, cents, err = readScl(strings.NewReader("cents\n2\n350.0 ! comment\n1200.\n"))
+	expectNoError(t, err)
+	expectNearlyEqual(t, cents[0], 350)
+	expectNearlyEqual(t, cents[1], 1200)
+}
+
+func TestKbm(t *testing.T) {
+	kbm := `! white keys only
+12
+0
+127
+60
+69
+440.0
+7
+! mapping
+0
+x
+1
+x
+2
+3
+x
+4
+x
+5
+x
+6
+`
+	k, err := readKbm(strings.NewReader(kbm))
+	expectNoError(t, err)
+	expectEqual(t, len(k.mapping), 12)
+	expectEqual(t, k.mapping[1], -1)
+	expectEqual(t, k.mapping[11], 6)
+
+	tuning := newTuning()
+	s := newTuning()
+	s.cents = []float64{200, 400, 500, 700, 900, 1100, 1200}
+	tuning.applyScale(s)
+	tuning.applyMapping(k)
+	expectNearlyEqual(t, tuning.freq(69), 440)
+	expectNearlyEqual(t, tuning.freq(72), 440*math.Pow(2, 0.25))
+	expectEqual(t, tuning.mapped(61), false)
+	expectEqual(t, tuning.mapped(59), true)
+	expectNearlyEqual(t, tuning.freq(48), tuning.freq(60)/2)
+}
@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+)
+
+const maxUnison = 16
+
+// ----- Unison Params ----- //
+
+type unisonParams struct {
+	voices int     // 1 ~ maxUnison
+	detune float64 // cents between the lowest and the highest voices
+	spread float64 // 0 ~ 1, stereo width
+}
+
+type unisonJSON struct {
+	Voices int     `json:"voices"`
+	Detune float64 `json:"detune"`
+	Spread float64 `json:"spread"`
+}
+
+func newUnisonParams() *unisonParams {
+	return &unisonParams{
+		voices: 1,
+		detune: 20,
+		spread: 0.5,
+	}
+}
+func (u *unisonParams) applyJSON(data json.RawMessage) {
+	var j unisonJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil || j.Voices < 1 || j.Voices > maxUnison {
+		log.Println("failed to apply JSON to unisonParams")
+		return
+	}
+	u.voices = j.Voices
+	u.detune = j.Detune
+	u.spread = j.Spread
+}
+func (u *unisonParams) toJSON() json.RawMessage {
+	return toRawMessage(&unisonJSON{
+		Voices: u.voices,
+		Detune: u.detune,
+		Spread: u.spread,
+	})
+}
+func (u *unisonParams) set(key string, value string) error {
+	switch key {
+	case "voices":
+		value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if value < 1 || value > maxUnison {
+			return fmt.Errorf("invalid number of unison voices %v", value)
+		}
+		u.voices = int(value)
+	case "detune":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		u.detune = value
+	case "spread":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		u.spread = value
+	}
+	return nil
+}
+func (u *unisonParams) continuousParam(key string) *float64 {
+	switch key {
+	case "detune":
+		return &u.detune
+	case "spread":
+		return &u.spread
+	}
+	return nil
+}
+
+// returns the frequency ratio and the pan (-1 ~ 1) of the i-th voice of n voices
+func (u *unisonParams) voice(i int, n int) (float64, float64) {
+	if n <= 1 {
+		return 1, 0
+	}
+	x := 2*float64(i)/float64(n-1) - 1
+	return math.Pow(2, x*u.detune/2/1200), x * u.spread
+}
+
+// keeps the loudness of stacked voices with random phases
+func unisonGain(n int) float64 {
+	return 1 / math.Sqrt(float64(n))
+}
+
+// same balance as mixParams.gains()
+func panGains(pan float64) (float64, float64) {
+	left := 1.0
+	right := 1.0
+	if pan > 0 {
+		left -= pan
+	} else {
+		right += pan
+	}
+	return left, right
+}
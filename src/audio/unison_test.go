@@ -0,0 +1,42 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnisonVoice(t *testing.T) {
+	u := newUnisonParams()
+	ratio, pan := u.voice(0, 1)
+	expectNearlyEqual(t, ratio, 1)
+	expectNearlyEqual(t, pan, 0)
+
+	u.detune = 100
+	u.spread = 1
+	ratio, pan = u.voice(0, 3)
+	expectNearlyEqual(t, ratio, math.Pow(2, -0.5/12))
+	expectNearlyEqual(t, pan, -1)
+	ratio, pan = u.voice(1, 3)
+	expectNearlyEqual(t, ratio, 1)
+	expectNearlyEqual(t, pan, 0)
+	ratio, pan = u.voice(2, 3)
+	expectNearlyEqual(t, ratio, math.Pow(2, 0.5/12))
+	expectNearlyEqual(t, pan, 1)
+}
+
+func TestUnisonPolyphony(t *testing.T) {
+	p := newParams()
+	p.unisonParams.voices = 16
+	o := newPolyOsc()
+	events := make([][]*midiEvent, samplesPerCycle*2)
+	outL := make([]float64, samplesPerCycle)
+	outR := make([]float64, samplesPerCycle)
+	for note := 0; note < maxPoly/16+1; note++ {
+		events[0] = append(events[0], &midiEvent{event: &noteOn{note: 60 + note, velocity: 100}})
+	}
+	o.calc(events, p.oscParams, p.fmParams, p.adsrParams, p.noteFilterParams, p.filterParams, p.formantParams, p.lfoParams, p.envelopeParams, p.expressionParams, p.velSense, p.velocityParams, newTuning(), p.glideParams, p.unisonParams, defaultBpm, []*echo{{delay: &delay{}}, {delay: &delay{}}}, outL, outR)
+	expectEqual(t, len(o.active), maxPoly)
+	expectEqual(t, len(o.pooled), 0)
+	expectEqual(t, o.active[0].voices, 16)
+	expectEqual(t, o.active[1].unison, 1)
+}
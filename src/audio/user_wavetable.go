@@ -0,0 +1,124 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	wavetableFrameSize = 2048 // samples per frame (same as Serum)
+	maxWavetableFrames = 256
+)
+
+// ----- User Wavetable ----- //
+
+// frames of a WAV file, each of which has band-limited tables for all notes
+type userWavetable struct {
+	name   string
+	frames []*WavetableSet
+}
+
+// loaded wavetables by path
+// (loaded before locking the state so that the audio thread is not blocked)
+var userWavetables = make(map[string]*userWavetable)
+var userWavetablesLock sync.Mutex
+
+func loadUserWavetable(path string) (*userWavetable, error) {
+	userWavetablesLock.Lock()
+	defer userWavetablesLock.Unlock()
+	if wt, ok := userWavetables[path]; ok {
+		return wt, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	samples, _, err := readWav(file)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := newUserWavetable(filepath.Base(path), samples)
+	if err != nil {
+		return nil, err
+	}
+	userWavetables[path] = wt
+	return wt, nil
+}
+
+func newUserWavetable(name string, samples []float64) (*userWavetable, error) {
+	numFrames := len(samples) / wavetableFrameSize
+	if numFrames == 0 {
+		return nil, fmt.Errorf("at least %v samples are required", wavetableFrameSize)
+	}
+	if numFrames > maxWavetableFrames {
+		numFrames = maxWavetableFrames
+	}
+	forward := NewFFT(wavetableFrameSize, false)
+	inverse := NewFFT(wavetableFrameSize, true)
+	frames := make([]*WavetableSet, numFrames)
+	for i := range frames {
+		frame := samples[i*wavetableFrameSize : (i+1)*wavetableFrameSize]
+		frames[i] = makeBandLimitedTablesFromFrame(frame, forward, inverse)
+	}
+	return &userWavetable{
+		name:   name,
+		frames: frames,
+	}, nil
+}
+
+// one mip level per octave, each limited for the highest note in the octave
+func makeBandLimitedTablesFromFrame(frame []float64, forward *FFT, inverse *FFT) *WavetableSet {
+	n := len(frame)
+	spectrum := make([]complex128, n)
+	for i, value := range frame {
+		spectrum[i] = complex(value, 0)
+	}
+	forward.Calc(spectrum)
+	spectrum[0] = 0 // removes DC
+	wts := &WavetableSet{tables: make([]*wavetable, 128)}
+	x := make([]complex128, n)
+	for octave := 0; octave*12 < 128; octave++ {
+		highest := octave*12 + 11
+		if highest > 127 {
+			highest = 127
+		}
+		partials := int(sampleRate / 2 / noteToFreq(highest))
+		if partials > n/2-1 {
+			partials = n/2 - 1
+		}
+		for i := range x {
+			if i <= partials || i >= n-partials {
+				x[i] = spectrum[i]
+			} else {
+				x[i] = 0
+			}
+		}
+		inverse.Calc(x)
+		wt := newWavetable(n)
+		wt.values = wt.values[0:n]
+		for i := range wt.values {
+			wt.values[i] = real(x[i])
+		}
+		for note := octave * 12; note <= highest; note++ {
+			wts.tables[note] = wt
+		}
+	}
+	return wts
+}
+
+// position: 0 ~ 1, morphs between adjacent frames
+func (u *userWavetable) getAtFreq(position float64, freq float64, phase float64, interpolation int) float64 {
+	position = math.Max(0, math.Min(1, position))
+	x := position * float64(len(u.frames)-1)
+	i := int(x)
+	value := u.frames[i].getAtFreq(freq, phase, interpolation)
+	if i+1 < len(u.frames) {
+		t := x - float64(i)
+		value = value*(1-t) + u.frames[i+1].getAtFreq(freq, phase, interpolation)*t
+	}
+	return value
+}
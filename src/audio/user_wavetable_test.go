@@ -0,0 +1,91 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTestWav(samples []float64) []byte {
+	var data bytes.Buffer
+	for _, value := range samples {
+		binary.Write(&data, binary.LittleEndian, int16(value*32767))
+	}
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+data.Len()))
+	b.WriteString("WAVE")
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16))
+	binary.Write(&b, binary.LittleEndian, uint16(wavFormatPCM))
+	binary.Write(&b, binary.LittleEndian, uint16(1))
+	binary.Write(&b, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&b, binary.LittleEndian, uint32(sampleRate*2))
+	binary.Write(&b, binary.LittleEndian, uint16(2))
+	binary.Write(&b, binary.LittleEndian, uint16(16))
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(data.Len()))
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestReadWav(t *testing.T) {
+	samples, format, err := readWav(bytes.NewReader(makeTestWav([]float64{0, 0.5, -0.5, 1})))
+	expectNoError(t, err)
+	expectEqual(t, format.channels, 1)
+	expectEqual(t, len(samples), 4)
+	expectNearlyEqual(t, samples[1], 0.5)
+	expectNearlyEqual(t, samples[2], -0.5)
+	_, _, err = readWav(bytes.NewReader([]byte("not a wav file")))
+	expectEqual(t, err != nil, true)
+}
+
+func TestUserWavetable(t *testing.T) {
+	// frame 0: sine, frame 1: sine + 100th harmonic
+	samples := make([]float64, wavetableFrameSize*2)
+	for i := 0; i < wavetableFrameSize; i++ {
+		phase := 2 * math.Pi * float64(i) / wavetableFrameSize
+		samples[i] = math.Sin(phase)
+		samples[wavetableFrameSize+i] = math.Sin(phase) + 0.5*math.Sin(100*phase)
+	}
+	wt, err := newUserWavetable("test", samples)
+	expectNoError(t, err)
+	expectEqual(t, len(wt.frames), 2)
+
+	phase := 2 * math.Pi * 3 / wavetableFrameSize
+	expectNearlyEqual(t, wt.getAtFreq(0, noteToFreq(20), phase, interpolationNone), math.Sin(phase))
+	expectNearlyEqual(t, wt.getAtFreq(1, noteToFreq(20), phase, interpolationNone), math.Sin(phase)+0.5*math.Sin(100*phase))
+	expectNearlyEqual(t, wt.getAtFreq(0.5, noteToFreq(20), phase, interpolationNone), math.Sin(phase)+0.25*math.Sin(100*phase))
+	// the 100th harmonic of a high note exceeds the Nyquist frequency
+	expectNearlyEqual(t, wt.getAtFreq(1, noteToFreq(100), phase, interpolationNone), math.Sin(phase))
+
+	_, err = newUserWavetable("short", samples[:100])
+	expectEqual(t, err != nil, true)
+
+	// the current wavetable is kept on errors
+	userWavetables["test.wav"] = wt
+	p := newOscParams()
+	expectNoError(t, p.setWavetable("test.wav"))
+	expectEqual(t, p.setWavetable("not_found.wav") != nil, true)
+	expectEqual(t, p.wavetable, "test.wav")
+	expectEqual(t, p.userWavetable, wt)
+	delete(userWavetables, "test.wav")
+}
+
+func TestPreloadParamsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wavetable")
+	expectNoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.wav")
+	expectNoError(t, ioutil.WriteFile(path, makeTestWav(make([]float64, wavetableFrameSize)), 0644))
+	p := newParams()
+	p.oscParams[1].wavetable = path
+	preloadParamsFiles(p.toJSON())
+	_, ok := userWavetables[path]
+	expectEqual(t, ok, true)
+	delete(userWavetables, path)
+}
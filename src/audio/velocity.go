@@ -0,0 +1,186 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ----- Velocity Curve ----- //
+
+//go:generate go run ../gen/main.go -- velocity_curve.gen.go
+/*
+generate-enum velocityCurve
+
+velocityLinear linear
+velocityExponential exponential
+velocityLogarithmic logarithmic
+velocitySCurve s-curve
+velocityCustom custom
+
+EOF
+*/
+
+const defaultReleaseVelocity = 64
+
+// ----- Velocity Params ----- //
+
+type velocityPoint struct {
+	Velocity int     `json:"velocity"` // 0 ~ 127
+	Value    float64 `json:"value"`    // 0 ~ 1
+}
+
+// the curve only shapes the response, whose depth is set by velSense
+// (so the curve has no effect while velSense is 0, the default)
+type velocityParams struct {
+	curve        int
+	points       []velocityPoint // sorted by velocity, used by the custom curve
+	releaseSense float64         // -1 ~ 1
+}
+
+type velocityJSON struct {
+	Curve        string          `json:"curve"`
+	Points       []velocityPoint `json:"points"`
+	ReleaseSense float64         `json:"releaseSense"`
+}
+
+func newVelocityParams() *velocityParams {
+	return &velocityParams{
+		curve:        velocityLinear,
+		points:       []velocityPoint{{Velocity: 0, Value: 0}, {Velocity: 127, Value: 1}},
+		releaseSense: 0,
+	}
+}
+func (v *velocityParams) applyJSON(data json.RawMessage) {
+	var j velocityJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		log.Println("failed to apply JSON to velocityParams")
+		return
+	}
+	err = v.setPoints(j.Points)
+	if err != nil {
+		log.Println("failed to apply JSON to velocityParams")
+		return
+	}
+	v.curve = velocityCurveFromString(j.Curve)
+	v.releaseSense = j.ReleaseSense
+}
+func (v *velocityParams) toJSON() json.RawMessage {
+	return toRawMessage(&velocityJSON{
+		Curve:        velocityCurveToString(v.curve),
+		Points:       v.points,
+		ReleaseSense: v.releaseSense,
+	})
+}
+func (v *velocityParams) set(key string, value string) error {
+	switch key {
+	case "curve":
+		v.curve = velocityCurveFromString(value)
+	case "points":
+		points, err := parseVelocityPoints(value)
+		if err != nil {
+			return err
+		}
+		return v.setPoints(points)
+	case "release_sense":
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.releaseSense = value
+	}
+	return nil
+}
+func (v *velocityParams) continuousParam(key string) *float64 {
+	switch key {
+	case "release_sense":
+		return &v.releaseSense
+	}
+	return nil
+}
+func (v *velocityParams) setPoints(points []velocityPoint) error {
+	if len(points) == 0 {
+		return fmt.Errorf("at least one point is required")
+	}
+	for _, p := range points {
+		if p.Velocity < 0 || p.Velocity > 127 {
+			return fmt.Errorf("invalid velocity %v", p.Velocity)
+		}
+	}
+	sorted := append([]velocityPoint{}, points...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Velocity < sorted[j].Velocity
+	})
+	v.points = sorted
+	return nil
+}
+
+// "0:0,64:0.3,127:1"
+func parseVelocityPoints(s string) ([]velocityPoint, error) {
+	points := make([]velocityPoint, 0)
+	for _, item := range strings.Split(s, ",") {
+		pair := strings.SplitN(item, ":", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid velocity point %v", item)
+		}
+		velocity, err := strconv.ParseInt(pair[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseFloat(pair[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, velocityPoint{Velocity: int(velocity), Value: value})
+	}
+	return points, nil
+}
+
+// ----- Velocity ----- //
+
+// returns 0 ~ 1
+func (v *velocityParams) value(velocity int) float64 {
+	x := float64(velocity) / 127
+	switch v.curve {
+	case velocityExponential:
+		return (math.Pow(16, x) - 1) / 15
+	case velocityLogarithmic:
+		return math.Log2(1+15*x) / 4
+	case velocitySCurve:
+		return x * x * (3 - 2*x)
+	case velocityCustom:
+		return interpolateVelocityPoints(v.points, velocity)
+	}
+	return x
+}
+
+func interpolateVelocityPoints(points []velocityPoint, velocity int) float64 {
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].Velocity >= velocity
+	})
+	if i == 0 {
+		return points[0].Value
+	}
+	if i == len(points) {
+		return points[len(points)-1].Value
+	}
+	p0 := points[i-1]
+	p1 := points[i]
+	t := float64(velocity-p0.Velocity) / float64(p1.Velocity-p0.Velocity)
+	return p0.Value + (p1.Value-p0.Value)*t
+}
+
+// fast release (high velocity) shortens the release when releaseSense > 0
+func (v *velocityParams) releaseRatio(velocity int) float64 {
+	return math.Pow(4, -float64(velocity-defaultReleaseVelocity)/64*v.releaseSense)
+}
+
+// velSense: 0 (constant gain) ~ 1 (the curve as is)
+func velocityToGain(velocity int, velSense float64, velocityParams *velocityParams) float64 {
+	return 1.0 - (1.0-velocityParams.value(velocity))*velSense
+}
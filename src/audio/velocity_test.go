@@ -0,0 +1,39 @@
+package audio
+
+import (
+	"testing"
+)
+
+func TestVelocityCurves(t *testing.T) {
+	p := newVelocityParams()
+	for _, curve := range []int{velocityLinear, velocityExponential, velocityLogarithmic, velocitySCurve} {
+		p.curve = curve
+		expectNearlyEqual(t, p.value(0), 0)
+		expectNearlyEqual(t, p.value(127), 1)
+	}
+	p.curve = velocityExponential
+	expectEqual(t, p.value(64) < 64.0/127, true)
+	p.curve = velocityLogarithmic
+	expectEqual(t, p.value(64) > 64.0/127, true)
+
+	p.curve = velocityCustom
+	expectNoError(t, p.set("points", "100:1,20:0.2"))
+	expectNearlyEqual(t, p.value(0), 0.2)
+	expectNearlyEqual(t, p.value(60), 0.6)
+	expectNearlyEqual(t, p.value(127), 1)
+
+	// the depth is set by velSense
+	p.curve = velocityExponential
+	expectNearlyEqual(t, velocityToGain(64, 0, p), 1)
+	expectNearlyEqual(t, velocityToGain(64, 1, p), p.value(64))
+	expectNearlyEqual(t, velocityToGain(64, 0.5, p), 1-(1-p.value(64))/2)
+}
+
+func TestReleaseVelocity(t *testing.T) {
+	p := newVelocityParams()
+	expectNearlyEqual(t, p.releaseRatio(127), 1)
+	p.releaseSense = 1
+	expectNearlyEqual(t, p.releaseRatio(defaultReleaseVelocity), 1)
+	expectNearlyEqual(t, p.releaseRatio(0), 4)
+	expectEqual(t, p.releaseRatio(127) < 1, true)
+}
@@ -0,0 +1,103 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// ----- WAV ----- //
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+type wavFormat struct {
+	format        int
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+}
+
+// returns samples of the first channel in -1 ~ 1
+func readWav(r io.Reader) ([]float64, *wavFormat, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, nil, fmt.Errorf("not a WAV file")
+	}
+	var format *wavFormat
+	var samples []byte
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+		if pos+size > len(data) {
+			size = len(data) - pos
+		}
+		chunk := data[pos : pos+size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, nil, fmt.Errorf("invalid fmt chunk")
+			}
+			format = &wavFormat{
+				format:        int(binary.LittleEndian.Uint16(chunk[0:2])),
+				channels:      int(binary.LittleEndian.Uint16(chunk[2:4])),
+				sampleRate:    int(binary.LittleEndian.Uint32(chunk[4:8])),
+				bitsPerSample: int(binary.LittleEndian.Uint16(chunk[14:16])),
+			}
+			if format.format == wavFormatExtensible && size >= 26 {
+				// the first 2 bytes of the sub format GUID
+				format.format = int(binary.LittleEndian.Uint16(chunk[24:26]))
+			}
+		case "data":
+			samples = chunk
+		}
+		pos += size + size%2 // chunks are word-aligned
+	}
+	if format == nil || samples == nil {
+		return nil, nil, fmt.Errorf("fmt or data chunk not found")
+	}
+	values, err := decodeWavSamples(samples, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, format, nil
+}
+
+func decodeWavSamples(data []byte, f *wavFormat) ([]float64, error) {
+	bytesPerSample := f.bitsPerSample / 8
+	if f.channels < 1 || bytesPerSample < 1 {
+		return nil, fmt.Errorf("invalid WAV format")
+	}
+	frameSize := bytesPerSample * f.channels
+	values := make([]float64, len(data)/frameSize)
+	for i := range values {
+		b := data[i*frameSize : i*frameSize+bytesPerSample]
+		switch {
+		case f.format == wavFormatPCM && bytesPerSample == 1:
+			values[i] = (float64(b[0]) - 128) / 128
+		case f.format == wavFormatPCM && bytesPerSample == 2:
+			values[i] = float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		case f.format == wavFormatPCM && bytesPerSample == 3:
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			values[i] = float64(v) / (1 << 23)
+		case f.format == wavFormatPCM && bytesPerSample == 4:
+			values[i] = float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		case f.format == wavFormatFloat && bytesPerSample == 4:
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case f.format == wavFormatFloat && bytesPerSample == 8:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		default:
+			return nil, fmt.Errorf("unsupported WAV format %v (%v bits)", f.format, f.bitsPerSample)
+		}
+	}
+	return values, nil
+}
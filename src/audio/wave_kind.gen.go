@@ -13,6 +13,9 @@ const (
 	waveSawWT
 	waveSawRev
 	waveNoise
+	waveWavetable
+	waveAdditive
+	waveSample
 )
 
 func waveKindFromString(s string) int {
@@ -37,6 +40,12 @@ func waveKindFromString(s string) int {
 		return waveSawRev
 	case "noise":
 		return waveNoise
+	case "wavetable":
+		return waveWavetable
+	case "additive":
+		return waveAdditive
+	case "sample":
+		return waveSample
 	}
 	return waveNone
 }
@@ -62,6 +71,12 @@ func waveKindToString(d int) string {
 		return "saw-rev"
 	case waveNoise:
 		return "noise"
+	case waveWavetable:
+		return "wavetable"
+	case waveAdditive:
+		return "additive"
+	case waveSample:
+		return "sample"
 	}
 	return "none"
 }
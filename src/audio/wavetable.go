@@ -7,6 +7,21 @@ import (
 	"os"
 )
 
+// ----- Interpolation ----- //
+
+//go:generate go run ../gen/main.go -- interpolation.gen.go
+/*
+generate-enum interpolation
+
+interpolationLinear linear
+interpolationCubic cubic
+interpolationNone none
+
+EOF
+*/
+
+// ----- Wavetable ----- //
+
 type wavetable struct {
 	values []float64
 }
@@ -36,6 +51,27 @@ func (wt *wavetable) getAtPhase(phase float64) float64 {
 	index := int(phase/phasePerSample) % length
 	return wt.values[index]
 }
+func (wt *wavetable) getAtPhaseWithInterpolation(phase float64, interpolation int) float64 {
+	if interpolation == interpolationNone {
+		return wt.getAtPhase(phase)
+	}
+	length := len(wt.values)
+	x := positiveMod(phase/(2.0*math.Pi), 1) * float64(length)
+	i := int(x)
+	t := x - float64(i)
+	y1 := wt.values[i%length]
+	y2 := wt.values[(i+1)%length]
+	if interpolation == interpolationLinear {
+		return y1 + (y2-y1)*t
+	}
+	// 4-point Hermite
+	y0 := wt.values[(i+length-1)%length]
+	y3 := wt.values[(i+2)%length]
+	c1 := 0.5 * (y2 - y0)
+	c2 := y0 - 2.5*y1 + 2*y2 - 0.5*y3
+	c3 := 0.5*(y3-y0) + 1.5*(y1-y2)
+	return ((c3*t+c2)*t+c1)*t + y1
+}
 func (wt *wavetable) makeBandLimitedTableForGivenNumberOfPartials(samples int, partials int, calcFourierPartialAtPhase func(n int, phase float64) float64) {
 	wt.generate(samples, func(phase float64) float64 {
 		value := 0.0
@@ -67,6 +103,17 @@ func NewWavetableSet(tableCap int, sampleCap int) *WavetableSet {
 	}
 }
 
+// crossfades the tables of adjacent notes by fractional pitch
+func (wts *WavetableSet) getAtFreq(freq float64, phase float64, interpolation int) float64 {
+	note, t := freqToNoteWithFraction(freq)
+	value := wts.tables[note].getAtPhaseWithInterpolation(phase, interpolation)
+	if t > 0 && note+1 < len(wts.tables) {
+		next := wts.tables[note+1].getAtPhaseWithInterpolation(phase, interpolation)
+		value = value*(1-t) + next*t
+	}
+	return value
+}
+
 // MakeBandLimitedTablesForAllNotes ...
 func (wts *WavetableSet) MakeBandLimitedTablesForAllNotes(samples int, calcFourierPartialAtPhase func(n int, phase float64) float64) error {
 	if cap(wts.tables) < 128 {
@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWavetableInterpolation(t *testing.T) {
+	wt := newWavetable(4)
+	wt.values = append(wt.values, 0, 1, 0, -1)
+	step := 2 * math.Pi / 4
+	for _, interpolation := range []int{interpolationNone, interpolationLinear, interpolationCubic} {
+		expectNearlyEqual(t, wt.getAtPhaseWithInterpolation(step, interpolation), 1)
+		expectNearlyEqual(t, wt.getAtPhaseWithInterpolation(step*3, interpolation), -1)
+	}
+	expectNearlyEqual(t, wt.getAtPhaseWithInterpolation(step*0.5, interpolationNone), 0)
+	expectNearlyEqual(t, wt.getAtPhaseWithInterpolation(step*0.5, interpolationLinear), 0.5)
+	expectNearlyEqual(t, wt.getAtPhaseWithInterpolation(step*3.5, interpolationLinear), -0.5)
+	// Hermite through (-1, -1), (0, 0), (1, 1), (2, 0)
+	expectNearlyEqual(t, wt.getAtPhaseWithInterpolation(step*0.5, interpolationCubic), 0.625)
+}
+
+func TestFreqToNoteWithFraction(t *testing.T) {
+	note, fraction := freqToNoteWithFraction(noteToFreq(60))
+	expectEqual(t, note, 60)
+	expectNearlyEqual(t, fraction, 0)
+	note, fraction = freqToNoteWithFraction(noteToFreq(60) * math.Pow(2, 0.25/12))
+	expectEqual(t, note, 60)
+	expectNearlyEqual(t, fraction, 0.25)
+	note, fraction = freqToNoteWithFraction(noteToFreq(127) * 2)
+	expectEqual(t, note, 127)
+	expectNearlyEqual(t, fraction, 0)
+}
+
+func TestWavetableSetCrossfade(t *testing.T) {
+	wts := NewWavetableSet(128, 1)
+	wts.tables = wts.tables[0:128]
+	for i, wt := range wts.tables {
+		wt.values = append(wt.values[:0], float64(i))
+	}
+	expectNearlyEqual(t, wts.getAtFreq(noteToFreq(60), 0, interpolationNone), 60)
+	expectNearlyEqual(t, wts.getAtFreq(noteToFreq(60)*math.Pow(2, 0.5/12), 0, interpolationNone), 60.5)
+}
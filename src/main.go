@@ -49,6 +49,7 @@ func main() {
 			a.AddMidiEvent(data)
 		}
 	}()
+	audio.SendToMidiOut(ctx, a.MidiOutCh)
 
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt, os.Kill, syscall.SIGTERM)
@@ -185,6 +186,33 @@ loop:
 				s := "preset_list " + url.PathEscape(string(j))
 				conn.Write([]byte(s + "\n"))
 			}
+			if audio.Changes.Has("sf2_list") {
+				audio.Changes.Delete("sf2_list")
+				j := audio.GetSF2ListJSON()
+				s := "sf2_list " + url.PathEscape(string(j))
+				conn.Write([]byte(s + "\n"))
+			}
+			if audio.Changes.Has("program_map") {
+				audio.Changes.Delete("program_map")
+				j, err := audio.GetProgramMapJSON()
+				if err != nil {
+					panic(err)
+				}
+				s := "program_map " + url.PathEscape(string(j))
+				conn.Write([]byte(s + "\n"))
+			}
+			if audio.Changes.Has("midi_settings") {
+				audio.Changes.Delete("midi_settings")
+				j := audio.GetMidiSettingsJSON()
+				s := "midi_settings " + url.PathEscape(string(j))
+				conn.Write([]byte(s + "\n"))
+			}
+			if audio.Changes.Has("tuning") {
+				audio.Changes.Delete("tuning")
+				j := audio.GetTuningJSON()
+				s := "tuning " + url.PathEscape(string(j))
+				conn.Write([]byte(s + "\n"))
+			}
 			if count%15 == 0 {
 				j := audio.GetStatusJSON()
 				s := "status " + url.PathEscape(string(j))